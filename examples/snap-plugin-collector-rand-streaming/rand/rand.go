@@ -75,21 +75,27 @@ func (r *RandCollector) StreamMetrics(
 	metrics_out chan []plugin.Metric,
 	err chan string) error {
 
-	go r.streamIt(metrics_out, err)
-	r.drainMetrics(metrics_in)
+	go r.streamIt(ctx, metrics_out, err)
+	r.drainMetrics(ctx, metrics_in)
 	return nil
 }
 
-func (r *RandCollector) drainMetrics(in chan []plugin.Metric) {
+func (r *RandCollector) drainMetrics(ctx context.Context, in chan []plugin.Metric) {
 	for {
-		var mts []plugin.Metric
-		mts = <-in
-		r.metrics = mts
+		select {
+		case mts := <-in:
+			r.metrics = mts
+		case <-ctx.Done():
+			return
+		}
 	}
 }
 
-func (r *RandCollector) streamIt(ch chan []plugin.Metric, err chan string) {
+func (r *RandCollector) streamIt(ctx context.Context, ch chan []plugin.Metric, err chan string) {
 	for {
+		if ctx.Err() != nil {
+			return
+		}
 		if r.metrics == nil {
 			time.Sleep(time.Second)
 			continue
@@ -125,7 +131,11 @@ func (r *RandCollector) streamIt(ch chan []plugin.Metric, err chan string) {
 				err <- fmt.Sprintf("Invalid namespace: %v", mt.Namespace.Strings())
 			}
 		}
-		ch <- metrics
+		select {
+		case ch <- metrics:
+		case <-ctx.Done():
+			return
+		}
 		time.Sleep(time.Millisecond * time.Duration(rand.Int63n(1000)))
 	}
 }
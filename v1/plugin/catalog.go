@@ -0,0 +1,123 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CatalogBuilder collects the metric types of a collector, returned by
+// GetMetricTypes, and checks them for mistakes snapteld would otherwise
+// only report when loading the plugin:
+//
+//	b := plugin.NewCatalogBuilder()
+//	b.Add(plugin.NewNamespace("intel", "net").AddDynamicElement("iface", "network interface").AddStaticElement("bytes"),
+//		plugin.KindCounter, "B", "bytes received")
+//	b.Add(plugin.NewNamespace("intel", "temp"), plugin.KindGauge, "C", "temperature")
+//	return b.Build()
+type CatalogBuilder struct {
+	metrics []Metric
+}
+
+// NewCatalogBuilder returns an empty CatalogBuilder.
+func NewCatalogBuilder() *CatalogBuilder {
+	return &CatalogBuilder{}
+}
+
+// Add adds a metric type of the namespace ns, with the given kind, unit
+// and description.
+func (b *CatalogBuilder) Add(ns Namespace, kind MetricKind, unit, description string) *CatalogBuilder {
+	return b.AddMetric(Metric{Namespace: ns, Kind: kind, Unit: unit, Description: description})
+}
+
+// AddMetric adds the metric type mt, e.g. to set its version or tags.
+func (b *CatalogBuilder) AddMetric(mt Metric) *CatalogBuilder {
+	mt.Namespace = CopyNamespace(mt.Namespace)
+	b.metrics = append(b.metrics, mt)
+	return b
+}
+
+// Build returns the metric types added to the builder, or an error listing
+// the problems found in them.
+func (b *CatalogBuilder) Build() ([]Metric, error) {
+	if errs := validateCatalog(b.metrics); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid metric catalog: %s", joinErrors(errs))
+	}
+	mts := make([]Metric, len(b.metrics))
+	copy(mts, b.metrics)
+	return mts, nil
+}
+
+// validateCatalog returns the problems found in the metric types mts:
+// empty namespaces and elements, dynamic elements without a name or with a
+// value other than "*" or "**", names of dynamic elements used twice in a
+// namespace, namespaces whose elements hold all the separators
+// Namespace.String can use, unknown kinds and metric types added twice.
+func validateCatalog(mts []Metric) []error {
+	var errs []error
+	seen := map[string]bool{}
+	for _, mt := range mts {
+		ns := mt.Namespace.String()
+		fail := func(format string, args ...interface{}) {
+			errs = append(errs, fmt.Errorf("metric %s (version %d): %s", ns, mt.Version, fmt.Sprintf(format, args...)))
+		}
+		if len(mt.Namespace) == 0 {
+			fail("empty namespace")
+		}
+		names := map[string]bool{}
+		for i, e := range mt.Namespace {
+			switch {
+			case e.Value == "":
+				fail("element %d is empty", i)
+			case (e.Value == "*" || e.Value == "**") && e.Name == "":
+				fail("element %d is dynamic but has no name, see AddDynamicElement", i)
+			case e.Name != "" && e.Value != "*" && e.Value != "**":
+				fail("element %d is named %q but its value %q is not \"*\" or \"**\"", i, e.Name, e.Value)
+			case e.Name != "" && names[e.Name]:
+				fail("element %d reuses the name %q", i, e.Name)
+			}
+			names[e.Name] = true
+		}
+		if len(mt.Namespace) > 0 && mt.Namespace.getSeparator() == nsCoreSeparator {
+			fail("elements hold all the namespace separators %s", strings.Join(nsPriorityList, " "))
+		}
+		switch mt.Kind {
+		case KindUnknown, KindGauge, KindCounter, KindDelta:
+		default:
+			fail("unknown kind %q", mt.Kind)
+		}
+		key := fmt.Sprintf("%s\x00%d", ns, mt.Version)
+		if seen[key] {
+			fail("added more than once")
+		}
+		seen[key] = true
+	}
+	return errs
+}
+
+// joinErrors joins the messages of errs with "; ".
+func joinErrors(errs []error) string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
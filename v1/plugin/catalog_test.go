@@ -0,0 +1,77 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCatalogBuilder(t *testing.T) {
+	Convey("Test building metric catalogs", t, func() {
+		Convey("valid catalog", func() {
+			ns := NewNamespace("intel", "net").AddDynamicElement("iface", "network interface").AddStaticElement("bytes")
+			mts, err := NewCatalogBuilder().
+				Add(ns, KindCounter, "B", "bytes received").
+				Add(NewNamespace("intel", "temp"), KindGauge, "C", "temperature").
+				AddMetric(Metric{Namespace: NewNamespace("intel", "temp"), Version: 2}).
+				Build()
+			So(err, ShouldBeNil)
+			So(mts, ShouldHaveLength, 3)
+			So(mts[0], ShouldResemble, Metric{Namespace: ns, Kind: KindCounter, Unit: "B", Description: "bytes received"})
+		})
+		Convey("named dynamic elements matching many elements", func() {
+			ns := NewNamespace("intel", "fs").AddDynamicElement("path", "mount point").AddStaticElement("free")
+			ns[2].Value = "**"
+			_, err := NewCatalogBuilder().Add(ns, KindGauge, "B", "free space").Build()
+			So(err, ShouldBeNil)
+		})
+		Convey("invalid catalog", func() {
+			allSeparators := NewNamespace(append([]string{"x"}, nsPriorityList...)...)
+			_, err := NewCatalogBuilder().
+				Add(NewNamespace(), KindGauge, "", "").
+				Add(NewNamespace("a", ""), KindGauge, "", "").
+				Add(NewNamespace("a", "*"), KindGauge, "", "").
+				Add(Namespace{{Value: "b", Name: "n"}}, KindGauge, "", "").
+				Add(NewNamespace("c").AddDynamicElement("n", "").AddDynamicElement("n", ""), KindGauge, "", "").
+				Add(allSeparators, KindGauge, "", "").
+				Add(NewNamespace("d"), MetricKind("histogram"), "", "").
+				Add(NewNamespace("e"), KindGauge, "", "").
+				Add(NewNamespace("e"), KindCounter, "", "").
+				Build()
+			So(err, ShouldNotBeNil)
+			for _, msg := range []string{
+				"empty namespace",
+				"metric /a/ (version 0): element 1 is empty",
+				"element 1 is dynamic but has no name",
+				`element 0 is named "n" but its value "b" is not "*" or "**"`,
+				`element 2 reuses the name "n"`,
+				"hold all the namespace separators",
+				`unknown kind "histogram"`,
+				"metric /e (version 0): added more than once",
+			} {
+				So(err.Error(), ShouldContainSubstring, msg)
+			}
+		})
+	})
+}
@@ -20,6 +20,9 @@ limitations under the License.
 package plugin
 
 import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
 
 	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin/rpc"
@@ -31,6 +34,14 @@ type collectorProxy struct {
 	pluginProxy
 
 	plugin Collector
+
+	// catalog of kinds declared by GetMetricTypes, given to collected
+	// metrics which do not set one. snapteld may have asked another
+	// instance of the plugin for the catalog, so it is loaded by the first
+	// collection needing it if GetMetricTypes was not called.
+	kindsMtx    sync.RWMutex
+	kinds       []Metric
+	kindsLoaded bool
 }
 
 func (c *collectorProxy) CollectMetrics(ctx context.Context, arg *rpc.MetricsArg) (*rpc.MetricsReply, error) {
@@ -40,12 +51,37 @@ func (c *collectorProxy) CollectMetrics(ctx context.Context, arg *rpc.MetricsArg
 		metric := fromProtoMetric(mt)
 		metrics = append(metrics, metric)
 	}
-	r, err := c.plugin.CollectMetrics(metrics)
-	if err != nil {
+	if err := c.checkMetricsConfig(metrics); err != nil {
+		return nil, err
+	}
+	ctx = withTask(ctx)
+	var cfg Config
+	if len(metrics) > 0 {
+		cfg = metrics[0].Config
+	}
+	if err := c.trackTask(ctx, cfg); err != nil {
+		return nil, err
+	}
+	r, err := collectMetrics(ctx, c.plugin, metrics)
+	perr, partial := asPartialError(err)
+	if partial {
+		// send the metrics which could be collected, with the failures
+		task, _ := TaskFromContext(ctx)
+		for _, me := range perr.Errors {
+			log.WithFields(log.Fields{
+				"task-id":   task.ID,
+				"namespace": me.Namespace.String(),
+				"error":     me.Err,
+			}).Warn("Failed to collect metrics")
+		}
+	} else if err != nil {
 		return nil, err
 	}
 	mts := []*rpc.Metric{}
 	for _, mt := range r {
+		if mt.Kind == KindUnknown {
+			mt.Kind = c.kindOf(mt.Namespace, metrics)
+		}
 		metric, err := toProtoMetric(mt)
 		if err != nil {
 			return nil, err
@@ -53,6 +89,11 @@ func (c *collectorProxy) CollectMetrics(ctx context.Context, arg *rpc.MetricsArg
 		mts = append(mts, metric)
 	}
 	reply := &rpc.MetricsReply{Metrics: mts}
+	// Snap drops the metrics of a reply with an error, so the failures are
+	// only reported in it when there is nothing to lose
+	if partial && len(mts) == 0 {
+		reply.Error = perr.Error()
+	}
 	return reply, nil
 }
 
@@ -63,6 +104,13 @@ func (c *collectorProxy) GetMetricTypes(ctx context.Context, arg *rpc.GetMetricT
 	if err != nil {
 		return nil, err
 	}
+	if err := c.checkCatalog(r); err != nil {
+		return nil, err
+	}
+	c.kindsMtx.Lock()
+	c.setKinds(r)
+	c.kindsMtx.Unlock()
+
 	metrics := []*rpc.Metric{}
 	for _, mt := range r {
 		// We can ignore this error since we are not returning data from
@@ -75,3 +123,52 @@ func (c *collectorProxy) GetMetricTypes(ctx context.Context, arg *rpc.GetMetricT
 	}
 	return reply, nil
 }
+
+// kindOf returns the kind of the namespace, as sent by snapteld with the
+// requested metrics or declared by GetMetricTypes.
+func (c *collectorProxy) kindOf(ns Namespace, requested []Metric) MetricKind {
+	for _, mt := range requested {
+		if mt.Kind != KindUnknown && mt.Namespace.Matches(ns) {
+			return mt.Kind
+		}
+	}
+	c.loadKinds(requested)
+	c.kindsMtx.RLock()
+	defer c.kindsMtx.RUnlock()
+	for _, mt := range c.kinds {
+		if mt.Namespace.Matches(ns) {
+			return mt.Kind
+		}
+	}
+	return KindUnknown
+}
+
+// loadKinds loads the catalog of kinds from GetMetricTypes, with the config
+// of the requested metrics, if it was not loaded yet.
+func (c *collectorProxy) loadKinds(requested []Metric) {
+	c.kindsMtx.Lock()
+	defer c.kindsMtx.Unlock()
+	if c.kindsLoaded {
+		return
+	}
+	cfg := Config{}
+	if len(requested) > 0 && requested[0].Config != nil {
+		cfg = requested[0].Config
+	}
+	// the catalog is only loaded once, a failure leaves kinds unknown
+	mts, _ := c.plugin.GetMetricTypes(cfg)
+	c.setKinds(mts)
+}
+
+// setKinds records the kinds declared by the metric types mts. The caller
+// holds kindsMtx.
+func (c *collectorProxy) setKinds(mts []Metric) {
+	var kinds []Metric
+	for _, mt := range mts {
+		if mt.Kind != KindUnknown {
+			kinds = append(kinds, Metric{Namespace: mt.Namespace, Kind: mt.Kind})
+		}
+	}
+	c.kinds = kinds
+	c.kindsLoaded = true
+}
@@ -26,6 +26,8 @@ import (
 	"testing"
 
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin/rpc"
 	. "github.com/smartystreets/goconvey/convey"
@@ -106,6 +108,47 @@ func TestCollectMetrics(t *testing.T) {
 	})
 }
 
+func TestCollectMetricsValidateConfig(t *testing.T) {
+	Convey("Test CollectMetrics with config validation enabled", t, func() {
+		cp := collectorProxy{
+			pluginProxy: *newPluginProxy(newMockCollector()),
+			plugin:      newMockCollector(),
+		}
+		cp.validateConfig = true
+		metric := func(cfg map[string]string, ns ...string) *rpc.Metric {
+			elements := []*rpc.NamespaceElement{}
+			for _, v := range ns {
+				elements = append(elements, &rpc.NamespaceElement{Value: v})
+			}
+			return &rpc.Metric{
+				Namespace:          elements,
+				Timestamp:          &rpc.Time{},
+				LastAdvertisedTime: &rpc.Time{},
+				Config:             &rpc.ConfigMap{StringMap: cfg},
+			}
+		}
+
+		Convey("config of other namespaces should not be checked", func() {
+			_, err := cp.CollectMetrics(context.Background(), &rpc.MetricsArg{
+				Metrics: []*rpc.Metric{metric(map[string]string{"cacheTime": "x"}, "other", "metric")},
+			})
+			So(err, ShouldBeNil)
+		})
+		Convey("config breaking the policy of the namespace should be rejected", func() {
+			_, err := cp.CollectMetrics(context.Background(), &rpc.MetricsArg{
+				Metrics: []*rpc.Metric{
+					metric(map[string]string{"cacheTime": "x"}, "abc", "metric"),
+					metric(map[string]string{"cacheTime": "x"}, "abc", "other"),
+				},
+			})
+			So(err, ShouldNotBeNil)
+			st, _ := status.FromError(err)
+			So(st.Code(), ShouldEqual, codes.InvalidArgument)
+			So(st.Message(), ShouldEqual, `config rejected by config policy: namespace "abc", key "cacheTime": expected integer, got string`)
+		})
+	})
+}
+
 func getTestMetricData() map[string]*rpc.Metric {
 	mp := map[string]*rpc.Metric{}
 
@@ -237,3 +280,116 @@ func getTestMetricData() map[string]*rpc.Metric {
 	}
 	return mp
 }
+
+func TestCollectMetricsPartialError(t *testing.T) {
+	Convey("Test CollectMetrics returning a PartialError", t, func() {
+		mc := newMockCollector()
+		cp := collectorProxy{
+			pluginProxy: *newPluginProxy(mc),
+			plugin:      mc,
+		}
+		Convey("metrics which could be collected should be sent", func() {
+			mc.doCollectMetrics = func([]Metric) ([]Metric, error) {
+				var perr PartialError
+				perr.Add(NewNamespace("temp"), fmt.Errorf("no sensor"))
+				return []Metric{{Namespace: NewNamespace("load"), Data: 1}}, &perr
+			}
+			reply, err := cp.CollectMetrics(context.Background(), &rpc.MetricsArg{})
+			So(err, ShouldBeNil)
+			So(reply.Metrics, ShouldHaveLength, 1)
+			So(fromProtoMetric(reply.Metrics[0]).Namespace.String(), ShouldEqual, "/load")
+			So(reply.Error, ShouldBeEmpty)
+		})
+		Convey("failures should be reported if no metric could be collected", func() {
+			mc.doCollectMetrics = func([]Metric) ([]Metric, error) {
+				var perr PartialError
+				perr.Add(NewNamespace("temp"), fmt.Errorf("no sensor"))
+				perr.Add(NewNamespace("load"), fmt.Errorf("no proc"))
+				return nil, &perr
+			}
+			reply, err := cp.CollectMetrics(context.Background(), &rpc.MetricsArg{})
+			So(err, ShouldBeNil)
+			So(reply.Metrics, ShouldBeEmpty)
+			So(reply.Error, ShouldEqual, "failed to collect 2 metric(s): /temp: no sensor; /load: no proc")
+		})
+		Convey("an empty PartialError should not be an error", func() {
+			var perr PartialError
+			So(perr.ErrorOrNil(), ShouldBeNil)
+		})
+	})
+}
+
+func TestCollectMetricsKinds(t *testing.T) {
+	Convey("Test CollectMetrics with kinds declared in the catalog", t, func() {
+		mc := newMockCollector()
+		catalogCalls := 0
+		mc.doGetMetricTypes = func(Config) ([]Metric, error) {
+			catalogCalls++
+			return []Metric{
+				NewNamespace("net").AddDynamicElement("iface", "interface").AddStaticElement("bytes").Counter(),
+				NewNamespace("temp").Gauge(),
+				NewNamespace("other").Gauge(),
+			}, nil
+		}
+		mc.doCollectMetrics = func([]Metric) ([]Metric, error) {
+			return []Metric{
+				{Namespace: NewNamespace("net", "eth0", "bytes"), Data: uint64(1)},
+				{Namespace: NewNamespace("temp"), Data: 21.5},
+				{Namespace: NewNamespace("other"), Data: 1, Kind: KindDelta},
+				{Namespace: NewNamespace("unknown"), Data: 1},
+			}, nil
+		}
+		cp := collectorProxy{
+			pluginProxy: *newPluginProxy(mc),
+			plugin:      mc,
+		}
+		collectKinds := func(arg *rpc.MetricsArg) []MetricKind {
+			reply, err := cp.CollectMetrics(context.Background(), arg)
+			So(err, ShouldBeNil)
+			kinds := []MetricKind{}
+			for _, m := range reply.GetMetrics() {
+				kinds = append(kinds, fromProtoMetric(m).Kind)
+			}
+			return kinds
+		}
+
+		Convey("kinds should be filled in after GetMetricTypes", func() {
+			_, err := cp.GetMetricTypes(context.Background(), &rpc.GetMetricTypesArg{})
+			So(err, ShouldBeNil)
+			So(collectKinds(&rpc.MetricsArg{}), ShouldResemble, []MetricKind{KindCounter, KindGauge, KindDelta, KindUnknown})
+			So(catalogCalls, ShouldEqual, 1)
+		})
+		Convey("a fresh proxy should load the catalog once", func() {
+			So(collectKinds(&rpc.MetricsArg{}), ShouldResemble, []MetricKind{KindCounter, KindGauge, KindDelta, KindUnknown})
+			So(collectKinds(&rpc.MetricsArg{}), ShouldResemble, []MetricKind{KindCounter, KindGauge, KindDelta, KindUnknown})
+			So(catalogCalls, ShouldEqual, 1)
+		})
+		Convey("kinds of the requested metrics should be preferred", func() {
+			requested, err := toProtoMetric(NewNamespace("temp").Delta())
+			So(err, ShouldBeNil)
+			So(collectKinds(&rpc.MetricsArg{Metrics: []*rpc.Metric{requested}}), ShouldResemble, []MetricKind{KindCounter, KindDelta, KindDelta, KindUnknown})
+		})
+	})
+}
+
+func TestGetMetricTypesValidateCatalog(t *testing.T) {
+	Convey("Test GetMetricTypes with catalog validation enabled", t, func() {
+		mc := newMockCollector()
+		mc.doGetMetricTypes = func(Config) ([]Metric, error) {
+			return []Metric{{Namespace: NewNamespace("a", "*")}}, nil
+		}
+		cp := collectorProxy{
+			pluginProxy: *newPluginProxy(mc),
+			plugin:      mc,
+		}
+		_, err := cp.GetMetricTypes(context.Background(), &rpc.GetMetricTypesArg{})
+		So(err, ShouldBeNil)
+
+		cp.validateCatalog = true
+		_, err = cp.GetMetricTypes(context.Background(), &rpc.GetMetricTypesArg{})
+		So(err, ShouldNotBeNil)
+		st, _ := status.FromError(err)
+		So(st.Code(), ShouldEqual, codes.InvalidArgument)
+		So(err.Error(), ShouldContainSubstring, "element 1 is dynamic but has no name")
+	})
+}
@@ -0,0 +1,213 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import "fmt"
+
+// CollectorFunc collects the requested metrics mts, which all match the
+// metric type the function is registered for in a CollectorRegistry.
+type CollectorFunc func(mts []Metric) ([]Metric, error)
+
+// CollectorRegistry implements GetMetricTypes and CollectMetrics of a
+// Collector by dispatching requests to functions registered per metric
+// type. A collector can embed it and only implement GetConfigPolicy:
+//
+//	type netCollector struct {
+//		*plugin.CollectorRegistry
+//	}
+//
+//	r := plugin.NewCollectorRegistry()
+//	r.Register(plugin.NewNamespace("intel", "net").AddDynamicElement("iface", "network interface").AddStaticElement("bytes").Counter(),
+//		collectBytes)
+//	plugin.StartCollector(netCollector{r}, "net", 1)
+//
+// All functions must be registered before the plugin is started.
+type CollectorRegistry struct {
+	entries []registryEntry
+}
+
+type registryEntry struct {
+	metric  Metric
+	collect CollectorFunc
+}
+
+// NewCollectorRegistry returns an empty CollectorRegistry.
+func NewCollectorRegistry() *CollectorRegistry {
+	return &CollectorRegistry{}
+}
+
+// Register registers the function collecting the metric type mt, whose
+// namespace may hold dynamic elements, including "**" ones. The metric type
+// is listed by GetMetricTypes with its version, unit, description, kind and
+// tags. Registering the same namespace pattern and version twice is an
+// error.
+func (r *CollectorRegistry) Register(mt Metric, fn CollectorFunc) error {
+	for _, e := range r.entries {
+		if e.metric.Version == mt.Version && e.metric.Namespace.Pattern() == mt.Namespace.Pattern() {
+			return fmt.Errorf("metric %s (version %d) is already registered", mt.Namespace, mt.Version)
+		}
+	}
+	mt.Namespace = CopyNamespace(mt.Namespace)
+	r.entries = append(r.entries, registryEntry{metric: mt, collect: fn})
+	return nil
+}
+
+// GetMetricTypes returns the registered metric types.
+func (r *CollectorRegistry) GetMetricTypes(cfg Config) ([]Metric, error) {
+	mts := make([]Metric, len(r.entries))
+	for i, e := range r.entries {
+		mts[i] = e.metric
+		mts[i].Namespace = CopyNamespace(e.metric.Namespace)
+	}
+	return mts, nil
+}
+
+// CollectMetrics calls the functions registered for the requested metrics
+// mts, each once with the requested metrics matching its metric type, see
+// Namespace.Extract.
+//
+// A failing function does not fail the others: its error is returned in a
+// PartialError for each of its requested metrics, together with the metrics
+// of the other functions. Functions may return a PartialError themselves.
+// A function returning a metric which was not requested fails the same way,
+// none of its metrics is returned, and so do requested metrics matching no
+// registered metric type.
+//
+// Metrics returned by the functions get the names and descriptions of the
+// dynamic elements of their metric type, so functions only need to set the
+// values of the elements. Their unit, description and kind default to those
+// of the metric type.
+func (r *CollectorRegistry) CollectMetrics(mts []Metric) ([]Metric, error) {
+	var perr PartialError
+	requested := make([][]Metric, len(r.entries))
+	for _, mt := range mts {
+		i := r.entryOf(mt)
+		if i < 0 {
+			perr.Add(mt.Namespace, fmt.Errorf("no collector registered for version %d", mt.Version))
+			continue
+		}
+		requested[i] = append(requested[i], mt)
+	}
+	metrics := []Metric{}
+	for i, e := range r.entries {
+		if len(requested[i]) == 0 {
+			continue
+		}
+		collected, err := e.collect(requested[i])
+		fperr, partial := asPartialError(err)
+		if err != nil && !partial {
+			for _, mt := range requested[i] {
+				perr.Add(mt.Namespace, err)
+			}
+			continue
+		}
+		// a func returning a metric which was not requested is broken, none
+		// of its metrics is kept but those of the other funcs are
+		if mt, ok := unrequested(collected, requested[i]); ok {
+			err := fmt.Errorf("collector of %s returned metric %s which was not requested", e.metric.Namespace, mt.Namespace)
+			for _, req := range requested[i] {
+				perr.Add(req.Namespace, err)
+			}
+			continue
+		}
+		if partial {
+			perr.Errors = append(perr.Errors, fperr.Errors...)
+		}
+		for _, mt := range collected {
+			metrics = append(metrics, e.complete(mt))
+		}
+	}
+	return metrics, perr.ErrorOrNil()
+}
+
+// entryOf returns the index of the entry matching the requested metric mt,
+// preferring one of the same version, or -1.
+func (r *CollectorRegistry) entryOf(mt Metric) int {
+	found := -1
+	for i, e := range r.entries {
+		if e.metric.Namespace.Extract(mt.Namespace) == nil {
+			continue
+		}
+		if e.metric.Version == mt.Version {
+			return i
+		}
+		if found < 0 {
+			found = i
+		}
+	}
+	return found
+}
+
+// unrequested returns the first of the collected metrics which was not
+// requested, if any.
+func unrequested(collected, requested []Metric) (Metric, bool) {
+	for _, mt := range collected {
+		if !wasRequested(mt, requested) {
+			return mt, true
+		}
+	}
+	return Metric{}, false
+}
+
+// wasRequested tells whether the namespace of mt matches one of the
+// requested metrics, whose dynamic elements match any value.
+func wasRequested(mt Metric, requested []Metric) bool {
+	for _, req := range requested {
+		if req.Namespace.Extract(mt.Namespace) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// complete fills in the dynamic element names and the metadata the
+// collected metric mt does not set from the metric type of the entry. The
+// elements matched by a dynamic "**" element all get its name.
+func (e registryEntry) complete(mt Metric) Metric {
+	if starts, ok := e.metric.Namespace.match(mt.Namespace); ok {
+		ns := CopyNamespace(mt.Namespace)
+		for i, pe := range e.metric.Namespace {
+			if !pe.IsDynamic() {
+				continue
+			}
+			end := len(ns)
+			if i+1 < len(starts) {
+				end = starts[i+1]
+			}
+			for j := starts[i]; j < end; j++ {
+				if !ns[j].IsDynamic() {
+					ns[j].Name = pe.Name
+					ns[j].Description = pe.Description
+				}
+			}
+		}
+		mt.Namespace = ns
+	}
+	if mt.Unit == "" {
+		mt.Unit = e.metric.Unit
+	}
+	if mt.Description == "" {
+		mt.Description = e.metric.Description
+	}
+	if mt.Kind == KindUnknown {
+		mt.Kind = e.metric.Kind
+	}
+	return mt
+}
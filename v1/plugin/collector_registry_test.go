@@ -0,0 +1,133 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCollectorRegistry(t *testing.T) {
+	Convey("Test collector registry", t, func() {
+		bytesType := NewNamespace("intel", "net").AddDynamicElement("iface", "network interface").AddStaticElement("bytes").Counter()
+		bytesType.Unit = "B"
+		tempType := NewNamespace("intel", "temp").Gauge()
+
+		var calls [][]Metric
+		collectBytes := func(mts []Metric) ([]Metric, error) {
+			calls = append(calls, mts)
+			return []Metric{
+				{Namespace: NewNamespace("intel", "net", "eth0", "bytes"), Data: uint64(1)},
+				{Namespace: NewNamespace("intel", "net", "eth1", "bytes"), Data: uint64(2)},
+			}, nil
+		}
+		collectTemp := func(mts []Metric) ([]Metric, error) {
+			calls = append(calls, mts)
+			return []Metric{{Namespace: NewNamespace("intel", "temp"), Data: 21.5, Unit: "C"}}, nil
+		}
+		r := NewCollectorRegistry()
+		So(r.Register(bytesType, collectBytes), ShouldBeNil)
+		So(r.Register(tempType, collectTemp), ShouldBeNil)
+
+		Convey("registering a metric type twice should fail", func() {
+			So(r.Register(NewNamespace("intel", "temp").Gauge(), collectTemp), ShouldNotBeNil)
+		})
+		Convey("registered metric types should be listed", func() {
+			mts, err := r.GetMetricTypes(nil)
+			So(err, ShouldBeNil)
+			So(mts, ShouldResemble, []Metric{bytesType, tempType})
+		})
+		Convey("only functions of requested metrics should be called", func() {
+			mts, err := r.CollectMetrics([]Metric{{Namespace: bytesType.Namespace}})
+			So(err, ShouldBeNil)
+			So(calls, ShouldHaveLength, 1)
+			So(mts, ShouldHaveLength, 2)
+			So(mts[0].Namespace.Strings(), ShouldResemble, []string{"intel", "net", "eth0", "bytes"})
+			So(mts[0].Namespace[2].Name, ShouldEqual, "iface")
+			So(mts[0].Namespace[2].Description, ShouldEqual, "network interface")
+			So(mts[0].Unit, ShouldEqual, "B")
+			So(mts[0].Kind, ShouldEqual, KindCounter)
+		})
+		Convey("metadata set by functions should be kept", func() {
+			mts, err := r.CollectMetrics([]Metric{{Namespace: NewNamespace("intel", "temp")}})
+			So(err, ShouldBeNil)
+			So(mts[0].Unit, ShouldEqual, "C")
+			So(mts[0].Kind, ShouldEqual, KindGauge)
+		})
+		Convey("metrics which were not requested should be rejected", func() {
+			mts, err := r.CollectMetrics([]Metric{
+				{Namespace: NewNamespace("intel", "net", "eth0", "bytes")},
+				{Namespace: NewNamespace("intel", "temp")},
+			})
+			So(mts, ShouldHaveLength, 1)
+			So(mts[0].Namespace.String(), ShouldEqual, "/intel/temp")
+			perr, ok := err.(*PartialError)
+			So(ok, ShouldBeTrue)
+			So(perr.Errors, ShouldHaveLength, 1)
+			So(perr.Errors[0].Namespace.String(), ShouldEqual, "/intel/net/eth0/bytes")
+			So(err.Error(), ShouldContainSubstring, "/intel/net/eth1/bytes which was not requested")
+		})
+		Convey("metrics without function should be rejected", func() {
+			mts, err := r.CollectMetrics([]Metric{{Namespace: NewNamespace("intel", "cpu")}, {Namespace: NewNamespace("intel", "temp")}})
+			So(mts, ShouldHaveLength, 1)
+			So(calls, ShouldHaveLength, 1)
+			perr, ok := err.(*PartialError)
+			So(ok, ShouldBeTrue)
+			So(perr.Error(), ShouldEqual, "failed to collect 1 metric(s): /intel/cpu: no collector registered for version 0")
+		})
+		Convey("dynamic elements matching many elements should be named", func() {
+			fsType := NewNamespace("intel", "fs").AddDynamicElement("path", "mount point").AddStaticElement("free").Gauge()
+			fsType.Namespace[2].Value = "**"
+			So(r.Register(fsType, func([]Metric) ([]Metric, error) {
+				return []Metric{{Namespace: NewNamespace("intel", "fs", "var", "log", "free"), Data: 1}}, nil
+			}), ShouldBeNil)
+			mts, err := r.CollectMetrics([]Metric{{Namespace: fsType.Namespace}})
+			So(err, ShouldBeNil)
+			So(mts, ShouldHaveLength, 1)
+			So(mts[0].Namespace[2].Name, ShouldEqual, "path")
+			So(mts[0].Namespace[3].Name, ShouldEqual, "path")
+			So(mts[0].Namespace[4].IsDynamic(), ShouldBeFalse)
+		})
+		Convey("registering the same pattern twice should fail", func() {
+			static := NewNamespace("intel", "net", "*", "bytes").Counter()
+			So(r.Register(static, collectBytes), ShouldBeNil)
+			So(r.Register(bytesType, collectBytes), ShouldNotBeNil)
+		})
+		Convey("errors of functions should be returned", func() {
+			r.entries[1].collect = func([]Metric) ([]Metric, error) { return nil, errors.New("no sensor") }
+			_, err := r.CollectMetrics([]Metric{{Namespace: NewNamespace("intel", "temp")}})
+			So(err, ShouldNotBeNil)
+		})
+		Convey("errors of functions should not fail the others", func() {
+			r.entries[1].collect = func([]Metric) ([]Metric, error) { return nil, errors.New("no sensor") }
+			mts, err := r.CollectMetrics([]Metric{{Namespace: bytesType.Namespace}, {Namespace: NewNamespace("intel", "temp")}})
+			So(mts, ShouldHaveLength, 2)
+			perr, ok := err.(*PartialError)
+			So(ok, ShouldBeTrue)
+			So(perr.Errors, ShouldHaveLength, 1)
+			So(perr.Errors[0].Namespace.String(), ShouldEqual, "/intel/temp")
+			So(perr.Error(), ShouldEqual, "failed to collect 1 metric(s): /intel/temp: no sensor")
+		})
+	})
+}
@@ -19,6 +19,13 @@ limitations under the License.
 
 package plugin
 
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
 // Config is a type alias for map[string]interface{} to allow the
 // helper functions Get{String,Bool,Float,Int} to be defined.
 type Config map[string]interface{}
@@ -69,45 +76,29 @@ func (c Config) GetBool(key string) (bool, error) {
 }
 
 // GetFloat takes a given key and checks the config for both
-// that the key exists, and that it is of type float64.
+// that the key exists, and that it is a number. Integers are converted
+// to float64 if they can be represented exactly.
 // Returns an error if either of these is false.
 func (c Config) GetFloat(key string) (float64, error) {
-	var (
-		fout float64
-		val  interface{}
-		ok   bool
-	)
-
-	if val, ok = c[key]; !ok {
-		return fout, ErrConfigNotFound
-	}
-
-	if fout, ok = val.(float64); !ok {
-		return fout, ErrNotAFloat
+	val, ok := c[key]
+	if !ok {
+		return 0, ErrConfigNotFound
 	}
-
-	return fout, nil
+	return floatValue(val)
 }
 
 // GetInt takes a given key and checks the config for both
-// that the key exists, and that it is of type int64.
-// Returns an error if either of these is false.
+// that the key exists, and that it is a number. Other integer types and
+// floats without a fractional part are converted to int64.
+// Returns an error if either of these is false, ErrIntOverflow if the
+// number is out of the range of int64 and ErrLossyConversion if it has a
+// fractional part.
 func (c Config) GetInt(key string) (int64, error) {
-	var (
-		iout int64
-		val  interface{}
-		ok   bool
-	)
-
-	if val, ok = c[key]; !ok {
-		return iout, ErrConfigNotFound
-	}
-
-	if iout, ok = val.(int64); !ok {
-		return iout, ErrNotAnInt
+	val, ok := c[key]
+	if !ok {
+		return 0, ErrConfigNotFound
 	}
-
-	return iout, nil
+	return intValue(val)
 }
 
 // applyDefaults updates config with defaults from config policy
@@ -119,3 +110,100 @@ func (c Config) applyDefaults(cp ConfigPolicy) {
 		}
 	}
 }
+
+// applyNumberRules converts values of keys with an integer or float rule in
+// cp to int64 and float64, e.g. numbers of config read from JSON, which are
+// all float64. Strings holding a number are converted too, unless the key
+// also has a string rule. Values which cannot be converted are left as they
+// are, for the getters and ConfigPolicy.Validate to report.
+func (c Config) applyNumberRules(cp ConfigPolicy) {
+	stringKeys := map[string]bool{}
+	for _, p := range cp.stringRules {
+		for key := range p.Rules {
+			stringKeys[key] = true
+		}
+	}
+	convert := func(key string, to func(interface{}) (interface{}, error)) {
+		val, ok := c[key]
+		if !ok {
+			return
+		}
+		if s, isString := val.(string); isString {
+			if stringKeys[key] {
+				return
+			}
+			s = strings.TrimSpace(s)
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				val = i
+			} else if f, err := strconv.ParseFloat(s, 64); err == nil {
+				val = f
+			} else {
+				return
+			}
+		}
+		if v, err := to(val); err == nil {
+			c[key] = v
+		}
+	}
+	for _, p := range cp.integerRules {
+		for key := range p.Rules {
+			convert(key, func(v interface{}) (interface{}, error) { return intValue(v) })
+		}
+	}
+	for _, p := range cp.floatRules {
+		for key := range p.Rules {
+			convert(key, func(v interface{}) (interface{}, error) { return floatValue(v) })
+		}
+	}
+}
+
+// intValue converts any Go number to int64.
+func intValue(val interface{}) (int64, error) {
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return 0, ErrIntOverflow
+		}
+		return int64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		switch {
+		case math.IsNaN(f):
+			return 0, ErrLossyConversion
+		case f < math.MinInt64 || f >= math.MaxInt64:
+			return 0, ErrIntOverflow
+		case f != math.Trunc(f):
+			return 0, ErrLossyConversion
+		}
+		return int64(f), nil
+	}
+	return 0, ErrNotAnInt
+}
+
+// floatValue converts any Go number to float64.
+func floatValue(val interface{}) (float64, error) {
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := rv.Int()
+		f := float64(i)
+		// float64(math.MaxInt64) rounds up to 2^63, out of the range of int64
+		if f >= math.MaxInt64 || int64(f) != i {
+			return 0, ErrLossyConversion
+		}
+		return f, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := rv.Uint()
+		f := float64(u)
+		if f >= math.MaxUint64 || uint64(f) != u {
+			return 0, ErrLossyConversion
+		}
+		return f, nil
+	}
+	return 0, ErrNotAFloat
+}
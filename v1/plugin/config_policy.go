@@ -20,6 +20,10 @@ limitations under the License.
 package plugin
 
 import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin/rpc"
@@ -30,6 +34,10 @@ type ConfigPolicy struct {
 	floatRules   map[string]*rpc.FloatPolicy
 	integerRules map[string]*rpc.IntegerPolicy
 	stringRules  map[string]*rpc.StringPolicy
+
+	// stringConstraints holds the constraints of string rules by namespace
+	// and key, see stringRule.
+	stringConstraints map[string]map[string]*stringConstraints
 }
 
 func NewConfigPolicy() *ConfigPolicy {
@@ -126,17 +134,40 @@ func (c *ConfigPolicy) AddNewFloatRule(ns []string, key string, req bool, opts .
 // AddNewStringRule adds a new stringRule with the specified args to the stringRules map.
 // The required arguments are ns([]string), key(string), req(bool)
 // and optionally:
-//		plugin.SetDefaultString(string)
+//		plugin.SetDefaultString(string),
+//		plugin.SetAllowedStrings(...string),
+//		plugin.SetStringPattern(string),
+//		plugin.SetMinStringLength(int),
+//		plugin.SetMaxStringLength(int)
+// The constraints on allowed values, pattern and length are not sent to
+// snapteld, they are checked by Validate and by the plugin proxies before
+// calling the plugin. A default breaking them is rejected.
 func (c *ConfigPolicy) AddNewStringRule(ns []string, key string, req bool, opts ...stringRuleOpt) error {
 	if key == "" {
 		return ErrEmptyKey
 	}
-	rule := &rpc.StringRule{
-		Required: req,
+	rule := stringRule{
+		StringRule:        &rpc.StringRule{Required: req},
+		stringConstraints: &stringConstraints{},
 	}
 
 	for _, opt := range opts {
-		opt(rule)
+		opt(&rule)
+	}
+	if rule.err != nil {
+		return fmt.Errorf("invalid rule for key %q: %v", key, rule.err)
+	}
+	if rule.pattern != "" {
+		re, err := regexp.Compile(rule.pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern for key %q: %v", key, err)
+		}
+		rule.re = re
+	}
+	if rule.HasDefault {
+		if r, reason, ok := rule.stringConstraints.check(rule.Default); !ok {
+			return fmt.Errorf("default value for key %q breaks its %s constraint: %s", key, r, reason)
+		}
 	}
 	k := strings.Join(ns, ".") // Method used in daemon/ctree
 	if c.stringRules[k] == nil {
@@ -145,7 +176,18 @@ func (c *ConfigPolicy) AddNewStringRule(ns []string, key string, req bool, opts
 			Key:   ns,
 		}
 	}
-	c.stringRules[k].Rules[key] = rule
+	c.stringRules[k].Rules[key] = rule.StringRule
+	if c.stringConstraints == nil {
+		c.stringConstraints = map[string]map[string]*stringConstraints{}
+	}
+	if c.stringConstraints[k] == nil {
+		c.stringConstraints[k] = map[string]*stringConstraints{}
+	}
+	if rule.stringConstraints.empty() {
+		delete(c.stringConstraints[k], key)
+	} else {
+		c.stringConstraints[k][key] = rule.stringConstraints
+	}
 	return nil
 }
 
@@ -192,3 +234,216 @@ func newGetConfigPolicyReply(cfg ConfigPolicy) *rpc.GetConfigPolicyReply {
 		StringPolicy:  cfg.stringRules,
 	}
 }
+
+// ConfigError describes a config value which breaks a rule of a
+// ConfigPolicy.
+type ConfigError struct {
+	// Namespace of the policy holding the rule, joined with ".".
+	Namespace string
+	// Key of the config value.
+	Key string
+	// Rule is the broken rule: "required", "type", "minimum", "maximum",
+	// "allowed", "pattern", "min_length" or "max_length".
+	Rule string
+	// Reason describes how the value breaks the rule.
+	Reason string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("namespace %q, key %q: %s", e.Namespace, e.Key, e.Reason)
+}
+
+// Validate checks the given config against every rule of the policy and
+// returns a *ConfigError for each required key which is missing, each value
+// of the wrong type, each number outside of the rule's bounds and each string
+// breaking the constraints of its rule. A required key with a default value
+// is not reported as missing. Errors are sorted by namespace and key.
+func (c *ConfigPolicy) Validate(cfg Config) []error {
+	return c.validate(cfg, func([]string) bool { return true })
+}
+
+// validateNamespace is like Validate, but only checks the rules of policies
+// whose namespace is a prefix of ns, which is how snapteld applies config
+// to the metrics of a collector.
+func (c *ConfigPolicy) validateNamespace(cfg Config, ns Namespace) []error {
+	return c.validate(cfg, func(key []string) bool {
+		return isNamespacePrefix(key, ns)
+	})
+}
+
+func (c *ConfigPolicy) validate(cfg Config, applies func([]string) bool) []error {
+	var errs []*ConfigError
+	fail := func(ns, key, rule, format string, args ...interface{}) {
+		errs = append(errs, &ConfigError{Namespace: ns, Key: key, Rule: rule, Reason: fmt.Sprintf(format, args...)})
+	}
+	for ns, p := range c.stringRules {
+		if !applies(p.Key) {
+			continue
+		}
+		for key, rule := range p.Rules {
+			val, ok := cfg[key]
+			if !ok {
+				if rule.Required && !rule.HasDefault {
+					fail(ns, key, "required", "required string not provided")
+				}
+				continue
+			}
+			str, ok := val.(string)
+			if !ok {
+				if sc := c.stringConstraints[ns][key]; sc == nil || !sc.decodes(val) {
+					fail(ns, key, "type", "expected string, got %T", val)
+				}
+				continue
+			}
+			if sc := c.stringConstraints[ns][key]; sc != nil {
+				if r, reason, ok := sc.check(str); !ok {
+					fail(ns, key, r, "%s", reason)
+				}
+			}
+		}
+	}
+	for ns, p := range c.boolRules {
+		if !applies(p.Key) {
+			continue
+		}
+		for key, rule := range p.Rules {
+			val, ok := cfg[key]
+			if !ok {
+				if rule.Required && !rule.HasDefault {
+					fail(ns, key, "required", "required bool not provided")
+				}
+				continue
+			}
+			if _, ok := val.(bool); !ok {
+				fail(ns, key, "type", "expected bool, got %T", val)
+			}
+		}
+	}
+	for ns, p := range c.floatRules {
+		if !applies(p.Key) {
+			continue
+		}
+		for key, rule := range p.Rules {
+			val, ok := cfg[key]
+			if !ok {
+				if rule.Required && !rule.HasDefault {
+					fail(ns, key, "required", "required float not provided")
+				}
+				continue
+			}
+			f, ok := numberValue(val)
+			if !ok {
+				fail(ns, key, "type", "expected float, got %T", val)
+				continue
+			}
+			if rule.HasMin && f < rule.Minimum {
+				fail(ns, key, "minimum", "%v is below minimum %v", f, rule.Minimum)
+			}
+			if rule.HasMax && f > rule.Maximum {
+				fail(ns, key, "maximum", "%v is above maximum %v", f, rule.Maximum)
+			}
+		}
+	}
+	for ns, p := range c.integerRules {
+		if !applies(p.Key) {
+			continue
+		}
+		for key, rule := range p.Rules {
+			val, ok := cfg[key]
+			if !ok {
+				if rule.Required && !rule.HasDefault {
+					fail(ns, key, "required", "required integer not provided")
+				}
+				continue
+			}
+			// compared as int64, float64 loses precision above 2^53
+			i, err := intValue(val)
+			if err != nil {
+				fail(ns, key, "type", "expected integer, got %T", val)
+				continue
+			}
+			if rule.HasMin && i < rule.Minimum {
+				fail(ns, key, "minimum", "%v is below minimum %v", i, rule.Minimum)
+			}
+			if rule.HasMax && i > rule.Maximum {
+				fail(ns, key, "maximum", "%v is above maximum %v", i, rule.Maximum)
+			}
+		}
+	}
+	return sortedErrors(errs)
+}
+
+// validateStringConstraints only checks the string values of cfg against
+// the allowed values, patterns and lengths of their rules, which snapteld
+// does not know about, for the policies whose namespace applies.
+func (c *ConfigPolicy) validateStringConstraints(cfg Config, applies func([]string) bool) []error {
+	var errs []*ConfigError
+	for ns, p := range c.stringRules {
+		if !applies(p.Key) {
+			continue
+		}
+		for key, sc := range c.stringConstraints[ns] {
+			str, ok := cfg[key].(string)
+			if !ok {
+				continue
+			}
+			if r, reason, ok := sc.check(str); !ok {
+				errs = append(errs, &ConfigError{Namespace: ns, Key: key, Rule: r, Reason: reason})
+			}
+		}
+	}
+	return sortedErrors(errs)
+}
+
+// sortedErrors returns errs sorted by namespace and key, or nil.
+func sortedErrors(errs []*ConfigError) []error {
+	sort.Sort(configErrors(errs))
+	if len(errs) == 0 {
+		return nil
+	}
+	result := make([]error, len(errs))
+	for i, e := range errs {
+		result[i] = e
+	}
+	return result
+}
+
+type configErrors []*ConfigError
+
+func (e configErrors) Len() int      { return len(e) }
+func (e configErrors) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e configErrors) Less(i, j int) bool {
+	if e[i].Namespace != e[j].Namespace {
+		return e[i].Namespace < e[j].Namespace
+	}
+	return e[i].Key < e[j].Key
+}
+
+// isNamespacePrefix tells whether the policy namespace key is a prefix of
+// the metric namespace ns. Empty elements of key and "*" elements of either
+// match anything.
+func isNamespacePrefix(key []string, ns Namespace) bool {
+	if len(key) > len(ns) {
+		return false
+	}
+	for i, k := range key {
+		if k != "" && k != "*" && ns[i].Value != "*" && k != ns[i].Value {
+			return false
+		}
+	}
+	return true
+}
+
+// numberValue returns the value of any Go number as float64.
+func numberValue(v interface{}) (float64, bool) {
+	val := reflect.ValueOf(v)
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(val.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(val.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return val.Float(), true
+	}
+	return 0, false
+}
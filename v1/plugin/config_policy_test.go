@@ -22,6 +22,7 @@ limitations under the License.
 package plugin
 
 import (
+	"math"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -246,3 +247,95 @@ func configPolicyTestCases() []testCaseConfigPolicy {
 	}
 	return tc
 }
+
+func TestValidateConfigPolicy(t *testing.T) {
+	Convey("Test validating config against config policy", t, func() {
+		cp := NewConfigPolicy()
+		cp.AddNewStringRule([]string{"a"}, "name", true)
+		cp.AddNewStringRule([]string{"a"}, "mode", true, SetDefaultString("fast"))
+		cp.AddNewIntRule([]string{"a"}, "port", false, SetMinInt(1), SetMaxInt(65535))
+		cp.AddNewFloatRule([]string{"a"}, "ratio", false, SetMaxFloat(1))
+		cp.AddNewBoolRule([]string{"a"}, "debug", false)
+
+		Convey("valid config", func() {
+			errs := cp.Validate(Config{"name": "x", "port": float64(8080), "ratio": 0.5, "debug": true})
+			So(errs, ShouldBeEmpty)
+		})
+		Convey("missing required key", func() {
+			errs := cp.Validate(Config{})
+			So(errs, ShouldHaveLength, 1)
+			So(errs[0].Error(), ShouldContainSubstring, `key "name"`)
+		})
+		Convey("values out of bounds", func() {
+			errs := cp.Validate(Config{"name": "x", "port": int64(0), "ratio": 1.5})
+			So(errs, ShouldHaveLength, 2)
+		})
+		Convey("values of wrong type", func() {
+			errs := cp.Validate(Config{"name": 1, "port": 1.5, "debug": "yes"})
+			So(errs, ShouldHaveLength, 3)
+		})
+		Convey("errors should describe the broken rule in order", func() {
+			cp.AddNewStringRule([]string{"b"}, "name", true)
+			errs := cp.Validate(Config{"port": int64(70000)})
+			So(errs, ShouldHaveLength, 3)
+			So(errs[0], ShouldResemble, &ConfigError{Namespace: "a", Key: "name", Rule: "required", Reason: "required string not provided"})
+			So(errs[1].(*ConfigError).Rule, ShouldEqual, "maximum")
+			So(errs[1].Error(), ShouldEqual, `namespace "a", key "port": 70000 is above maximum 65535`)
+			So(errs[2].(*ConfigError).Namespace, ShouldEqual, "b")
+		})
+		Convey("integer bounds near the limits of int64", func() {
+			cp.AddNewIntRule([]string{"c"}, "big", false, SetMaxInt(math.MaxInt64-1))
+			So(cp.Validate(Config{"name": "x", "big": int64(math.MaxInt64 - 1)}), ShouldBeEmpty)
+			errs := cp.Validate(Config{"name": "x", "big": int64(math.MaxInt64)})
+			So(errs, ShouldHaveLength, 1)
+			So(errs[0].(*ConfigError).Rule, ShouldEqual, "maximum")
+			errs = cp.Validate(Config{"name": "x", "big": uint64(math.MaxUint64)})
+			So(errs, ShouldHaveLength, 1)
+			So(errs[0].(*ConfigError).Rule, ShouldEqual, "type")
+		})
+		Convey("only policies applying to a namespace", func() {
+			cp.AddNewStringRule([]string{"b"}, "host", true)
+			So(cp.validateNamespace(Config{}, NewNamespace("b", "c")), ShouldHaveLength, 1)
+			So(cp.validateNamespace(Config{}, NewNamespace("a").AddDynamicElement("x", "")), ShouldHaveLength, 1)
+			So(cp.validateNamespace(Config{}, NewNamespace("c")), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestValidateStringConstraints(t *testing.T) {
+	Convey("Test validating config against string rule constraints", t, func() {
+		cp := NewConfigPolicy()
+		So(cp.AddNewStringRule([]string{"a"}, "protocol", false, SetAllowedStrings("tcp", "udp")), ShouldBeNil)
+		So(cp.AddNewStringRule([]string{"a"}, "name", false, SetStringPattern(`^[a-z]+$`)), ShouldBeNil)
+		So(cp.AddNewStringRule([]string{"a"}, "token", false, SetMinStringLength(2), SetMaxStringLength(4)), ShouldBeNil)
+
+		Convey("valid config", func() {
+			So(cp.Validate(Config{"protocol": "udp", "name": "abc", "token": "żółw"}), ShouldBeEmpty)
+		})
+		Convey("broken constraints", func() {
+			errs := cp.Validate(Config{"protocol": "http", "name": "Abc", "token": "x"})
+			So(errs, ShouldHaveLength, 3)
+			So(errs[0].(*ConfigError).Rule, ShouldEqual, "pattern")
+			So(errs[1].Error(), ShouldEqual, `namespace "a", key "protocol": "http" is not one of ["tcp", "udp"]`)
+			So(errs[2].(*ConfigError).Rule, ShouldEqual, "min_length")
+			So(cp.Validate(Config{"token": "abcde"})[0].(*ConfigError).Rule, ShouldEqual, "max_length")
+		})
+		Convey("replaced rule drops its constraints", func() {
+			So(cp.AddNewStringRule([]string{"a"}, "protocol", false), ShouldBeNil)
+			So(cp.Validate(Config{"protocol": "http"}), ShouldBeEmpty)
+		})
+		Convey("invalid pattern", func() {
+			So(cp.AddNewStringRule([]string{"a"}, "bad", false, SetStringPattern(`(`)), ShouldNotBeNil)
+		})
+		Convey("default breaking the constraints", func() {
+			err := cp.AddNewStringRule([]string{"a"}, "mode", false, SetDefaultString("ftp"), SetAllowedStrings("tcp", "udp"))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, `default value for key "mode" breaks its allowed constraint: "ftp" is not one of ["tcp", "udp"]`)
+			So(cp.AddNewStringRule([]string{"a"}, "mode", false, SetDefaultString("tcp"), SetAllowedStrings("tcp", "udp")), ShouldBeNil)
+		})
+		Convey("constraints are not sent to snapteld", func() {
+			reply := newGetConfigPolicyReply(*cp)
+			So(reply.StringPolicy["a"].Rules["protocol"].String(), ShouldBeEmpty)
+		})
+	})
+}
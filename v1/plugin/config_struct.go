@@ -0,0 +1,440 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configTag is the struct tag read by PolicyFromStruct and Config.Decode.
+const configTag = "config"
+
+var (
+	durationType    = reflect.TypeOf(time.Duration(0))
+	stringSliceType = reflect.TypeOf([]string(nil))
+	stringMapType   = reflect.TypeOf(map[string]string(nil))
+)
+
+// configField is a struct field tagged with `config`.
+type configField struct {
+	index    int
+	name     string
+	typ      reflect.Type
+	kind     reflect.Kind
+	key      string
+	required bool
+	def      *string
+	min      *string
+	max      *string
+	allowed  *string
+	pattern  *string
+	minLen   *string
+	maxLen   *string
+}
+
+// PolicyFromStruct builds a config policy for the namespace ns from the
+// fields of the struct v, or of the struct v points to. Only fields tagged
+// with `config` are used, e.g.:
+//
+//	type config struct {
+//		Host  string  `config:"host,required"`
+//		Port  int     `config:"port,default=8086,min=1,max=65535"`
+//		Ratio float64 `config:"ratio,max=1"`
+//		Debug bool    `config:"debug,default=false"`
+//	}
+//
+// The tag holds the config key, which defaults to the field name, followed
+// by any of the options required, default=<value>, min=<value> and
+// max=<value>. String fields also take allowed=<value>|<value>...,
+// pattern=<regexp>, minlen=<length> and maxlen=<length>, see
+// SetAllowedStrings, SetStringPattern, SetMinStringLength and
+// SetMaxStringLength. A comma in an option value is escaped with a
+// backslash, which is doubled in the quoted tag, e.g.
+// `config:"name,pattern=^[a-z]{1\\,3}$"`. Fields of string, bool, integer
+// and float kinds are supported, as well as time.Duration,
+// []string and map[string]string fields, which get the rules of
+// AddNewDurationRule, AddNewStringSliceRule and AddNewStringMapRule. Their
+// defaults are written as "1m30s", "a|b" and "a=1|b=2". min and max only
+// apply to numbers and durations. A tag of "-" skips the field.
+//
+// Config of the policy can be read into the same struct with Config.Decode.
+func PolicyFromStruct(ns []string, v interface{}) (*ConfigPolicy, error) {
+	cp := NewConfigPolicy()
+	if err := cp.AddRulesFromStruct(ns, v); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// AddRulesFromStruct adds rules for the fields of the struct v to the
+// namespace ns of the policy, see PolicyFromStruct.
+func (c *ConfigPolicy) AddRulesFromStruct(ns []string, v interface{}) error {
+	fields, err := configFields(reflect.TypeOf(v))
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if err := c.addFieldRule(ns, f); err != nil {
+			return fmt.Errorf("field %s: %v", f.name, err)
+		}
+	}
+	return nil
+}
+
+func (c *ConfigPolicy) addFieldRule(ns []string, f configField) error {
+	if f.kind != reflect.String && (f.allowed != nil || f.pattern != nil || f.minLen != nil || f.maxLen != nil) {
+		return fmt.Errorf("allowed, pattern, minlen and maxlen only apply to strings")
+	}
+	if (f.typ == stringSliceType || f.typ == stringMapType) && (f.min != nil || f.max != nil) {
+		return fmt.Errorf("min and max only apply to numbers and durations")
+	}
+	switch f.typ {
+	case durationType:
+		var opts []durationRuleOpt
+		for _, o := range []struct {
+			val *string
+			opt func(time.Duration) durationRuleOpt
+		}{{f.def, SetDefaultDuration}, {f.min, SetMinDuration}, {f.max, SetMaxDuration}} {
+			if o.val == nil {
+				continue
+			}
+			d, err := time.ParseDuration(*o.val)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, o.opt(d))
+		}
+		return c.AddNewDurationRule(ns, f.key, f.required, opts...)
+	case stringSliceType:
+		var opts []stringSliceRuleOpt
+		if f.def != nil {
+			values := []string{}
+			if *f.def != "" {
+				values = strings.Split(*f.def, "|")
+			}
+			opts = append(opts, SetDefaultStringSlice(values...))
+		}
+		return c.AddNewStringSliceRule(ns, f.key, f.required, opts...)
+	case stringMapType:
+		var opts []stringMapRuleOpt
+		if f.def != nil {
+			m, err := decodeStringMap(strings.Replace(*f.def, "|", ",", -1))
+			if err != nil {
+				return err
+			}
+			opts = append(opts, SetDefaultStringMap(m))
+		}
+		return c.AddNewStringMapRule(ns, f.key, f.required, opts...)
+	}
+	switch f.kind {
+	case reflect.String:
+		if f.min != nil || f.max != nil {
+			return fmt.Errorf("min and max only apply to numbers")
+		}
+		var opts []stringRuleOpt
+		if f.def != nil {
+			opts = append(opts, SetDefaultString(*f.def))
+		}
+		if f.allowed != nil {
+			opts = append(opts, SetAllowedStrings(strings.Split(*f.allowed, "|")...))
+		}
+		if f.pattern != nil {
+			opts = append(opts, SetStringPattern(*f.pattern))
+		}
+		for _, o := range []struct {
+			val *string
+			opt func(int) stringRuleOpt
+		}{{f.minLen, SetMinStringLength}, {f.maxLen, SetMaxStringLength}} {
+			if o.val == nil {
+				continue
+			}
+			n, err := strconv.Atoi(*o.val)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, o.opt(n))
+		}
+		return c.AddNewStringRule(ns, f.key, f.required, opts...)
+	case reflect.Bool:
+		if f.min != nil || f.max != nil {
+			return fmt.Errorf("min and max only apply to numbers")
+		}
+		var opts []boolRuleOpt
+		if f.def != nil {
+			b, err := strconv.ParseBool(*f.def)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, SetDefaultBool(b))
+		}
+		return c.AddNewBoolRule(ns, f.key, f.required, opts...)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var opts []integerRuleOpt
+		for _, o := range []struct {
+			val *string
+			opt func(int64) integerRuleOpt
+		}{{f.def, SetDefaultInt}, {f.min, SetMinInt}, {f.max, SetMaxInt}} {
+			if o.val == nil {
+				continue
+			}
+			i, err := strconv.ParseInt(*o.val, 10, 64)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, o.opt(i))
+		}
+		return c.AddNewIntRule(ns, f.key, f.required, opts...)
+	case reflect.Float32, reflect.Float64:
+		var opts []floatRuleOpt
+		for _, o := range []struct {
+			val *string
+			opt func(float64) floatRuleOpt
+		}{{f.def, SetDefaultFloat}, {f.min, SetMinFloat}, {f.max, SetMaxFloat}} {
+			if o.val == nil {
+				continue
+			}
+			fl, err := strconv.ParseFloat(*o.val, 64)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, o.opt(fl))
+		}
+		return c.AddNewFloatRule(ns, f.key, f.required, opts...)
+	}
+	return fmt.Errorf("unsupported type %v", f.kind)
+}
+
+// Decode fills the struct v points to with config values, reading the
+// fields tagged with `config` as described for PolicyFromStruct. Values are
+// converted to the type of the field if possible: numbers between integer
+// and float fields as long as they fit, and strings are parsed for number,
+// bool, duration, list and map fields. Missing keys get the default value of
+// the tag; a missing required key without default results in an error, other
+// fields without a value are left untouched. Bounds are not checked, see ConfigPolicy.Validate.
+func (c Config) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config can only be decoded into a pointer to a struct, got %T", v)
+	}
+	fields, err := configFields(rv.Type())
+	if err != nil {
+		return err
+	}
+	sv := rv.Elem()
+	for _, f := range fields {
+		val, ok := c[f.key]
+		if !ok {
+			switch {
+			case f.def != nil:
+				val = *f.def
+				if f.typ == stringSliceType || f.typ == stringMapType {
+					val = strings.Replace(*f.def, "|", ",", -1)
+				}
+			case f.required:
+				return fmt.Errorf("config item %q: %v", f.key, ErrConfigNotFound)
+			default:
+				continue
+			}
+		}
+		if err := setConfigField(sv.Field(f.index), val); err != nil {
+			return fmt.Errorf("config item %q: %v", f.key, err)
+		}
+	}
+	return nil
+}
+
+// configFields returns the fields of the struct type t, or of the struct t
+// points to, tagged with `config`.
+func configFields(t reflect.Type) ([]configField, error) {
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected a struct, got %v", t)
+	}
+	var fields []configField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup(configTag)
+		if !ok || tag == "-" {
+			continue
+		}
+		if sf.PkgPath != "" {
+			return nil, fmt.Errorf("field %s: tagged field is not exported", sf.Name)
+		}
+		f := configField{index: i, name: sf.Name, typ: sf.Type, kind: sf.Type.Kind()}
+		parts := splitTagOptions(tag)
+		f.key = parts[0]
+		if f.key == "" {
+			f.key = sf.Name
+		}
+		for _, opt := range parts[1:] {
+			name, val := opt, ""
+			if i := strings.Index(opt, "="); i >= 0 {
+				name, val = opt[:i], opt[i+1:]
+			}
+			switch name {
+			case "required":
+				f.required = true
+			case "default":
+				f.def = &val
+			case "min":
+				f.min = &val
+			case "max":
+				f.max = &val
+			case "allowed":
+				f.allowed = &val
+			case "pattern":
+				f.pattern = &val
+			case "minlen":
+				f.minLen = &val
+			case "maxlen":
+				f.maxLen = &val
+			default:
+				return nil, fmt.Errorf("field %s: unknown config tag option %q", sf.Name, opt)
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// splitTagOptions splits the config tag at commas which are not escaped
+// with a backslash, e.g. the tag "name,pattern=^[a-z]{1\,3}$" has the options
+// "name" and "pattern=^[a-z]{1,3}$". Other backslashes are kept.
+func splitTagOptions(tag string) []string {
+	var (
+		parts []string
+		part  []byte
+	)
+	for i := 0; i < len(tag); i++ {
+		switch {
+		case tag[i] == '\\' && i+1 < len(tag) && tag[i+1] == ',':
+			part = append(part, ',')
+			i++
+		case tag[i] == ',':
+			parts = append(parts, string(part))
+			part = part[:0]
+		default:
+			part = append(part, tag[i])
+		}
+	}
+	return append(parts, string(part))
+}
+
+// setConfigField sets the field fv to the config value val, converting it
+// to the field's type.
+func setConfigField(fv reflect.Value, val interface{}) error {
+	var (
+		decoded interface{}
+		err     error
+	)
+	switch fv.Type() {
+	case durationType:
+		decoded, err = Config{"": val}.GetDuration("")
+	case stringSliceType:
+		decoded, err = Config{"": val}.GetStringSlice("")
+	case stringMapType:
+		decoded, err = Config{"": val}.GetStringMap("")
+	}
+	if err != nil {
+		return err
+	}
+	if decoded != nil {
+		fv.Set(reflect.ValueOf(decoded))
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		s, ok := val.(string)
+		if !ok {
+			return ErrNotAString
+		}
+		fv.SetString(s)
+	case reflect.Bool:
+		switch b := val.(type) {
+		case bool:
+			fv.SetBool(b)
+		case string:
+			parsed, err := strconv.ParseBool(b)
+			if err != nil {
+				return ErrNotABool
+			}
+			fv.SetBool(parsed)
+		default:
+			return ErrNotABool
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := configInt(val)
+		if err != nil {
+			return err
+		}
+		if fv.OverflowInt(i) {
+			return fmt.Errorf("value %v overflows %v", i, fv.Type())
+		}
+		fv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := configInt(val)
+		if err != nil {
+			return err
+		}
+		if i < 0 || fv.OverflowUint(uint64(i)) {
+			return fmt.Errorf("value %v overflows %v", i, fv.Type())
+		}
+		fv.SetUint(uint64(i))
+	case reflect.Float32, reflect.Float64:
+		var (
+			f   float64
+			err error
+		)
+		if s, isString := val.(string); isString {
+			if f, err = strconv.ParseFloat(s, 64); err != nil {
+				return ErrNotAFloat
+			}
+		} else if f, err = floatValue(val); err != nil {
+			return err
+		}
+		if fv.OverflowFloat(f) {
+			return fmt.Errorf("value %v overflows %v", f, fv.Type())
+		}
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %v", fv.Type())
+	}
+	return nil
+}
+
+// configInt converts a config value to int64, parsing strings holding an
+// integer.
+func configInt(val interface{}) (int64, error) {
+	if s, ok := val.(string); ok {
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, ErrNotAnInt
+		}
+		return i, nil
+	}
+	return intValue(val)
+}
@@ -0,0 +1,178 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type structConfig struct {
+	Host    string  `config:"host,required"`
+	Port    uint16  `config:"port,default=8086,min=1,max=65535"`
+	Ratio   float32 `config:"ratio,max=1"`
+	Debug   bool    `config:"debug,default=false"`
+	Retries int     `config:",default=3"`
+	Ignored string
+	Skipped string `config:"-"`
+}
+
+func TestPolicyFromStruct(t *testing.T) {
+	Convey("Test building config policy from struct tags", t, func() {
+		Convey("valid struct", func() {
+			cp, err := PolicyFromStruct([]string{"a", "b"}, &structConfig{})
+			So(err, ShouldBeNil)
+
+			So(cp.stringRules["a.b"].Rules["host"].Required, ShouldBeTrue)
+			port := cp.integerRules["a.b"].Rules["port"]
+			So(port.Default, ShouldEqual, 8086)
+			So(port.HasMin && port.HasMax, ShouldBeTrue)
+			So(port.Maximum, ShouldEqual, 65535)
+			So(cp.floatRules["a.b"].Rules["ratio"].Maximum, ShouldEqual, 1)
+			So(cp.boolRules["a.b"].Rules["debug"].HasDefault, ShouldBeTrue)
+			So(cp.integerRules["a.b"].Rules["Retries"].Default, ShouldEqual, 3)
+			So(cp.stringRules["a.b"].Rules, ShouldHaveLength, 1)
+		})
+		Convey("string constraints", func() {
+			cp, err := PolicyFromStruct([]string{"a"}, struct {
+				Protocol string `config:"protocol,allowed=tcp|udp"`
+				Name     string `config:"name,pattern=^[a-z]+$,minlen=1,maxlen=8"`
+			}{})
+			So(err, ShouldBeNil)
+			So(cp.stringConstraints["a"]["protocol"].allowed, ShouldResemble, []string{"tcp", "udp"})
+			So(cp.stringConstraints["a"]["name"].String(), ShouldEqual, "pattern: ^[a-z]+$, min length: 1, max length: 8")
+			_, err = PolicyFromStruct(nil, struct {
+				A int `config:"a,allowed=1|2"`
+			}{})
+			So(err, ShouldNotBeNil)
+		})
+		Convey("escaped commas in option values", func() {
+			cp, err := PolicyFromStruct([]string{"a"}, struct {
+				Name string `config:"name,pattern=^[a-z]{1\\,3}$,default=ab"`
+			}{})
+			So(err, ShouldBeNil)
+			So(cp.stringConstraints["a"]["name"].String(), ShouldEqual, "pattern: ^[a-z]{1,3}$")
+			So(cp.stringRules["a"].Rules["name"].Default, ShouldEqual, "ab")
+			So(splitTagOptions(`a,pattern=\d\,x`), ShouldResemble, []string{"a", `pattern=\d,x`})
+		})
+		Convey("options which do not apply to the field type", func() {
+			for _, v := range []interface{}{
+				struct {
+					A time.Duration `config:"a,pattern=^1"`
+				}{},
+				struct {
+					A time.Duration `config:"a,allowed=1s|2s"`
+				}{},
+				struct {
+					A []string `config:"a,minlen=1"`
+				}{},
+				struct {
+					A []string `config:"a,max=2"`
+				}{},
+				struct {
+					A map[string]string `config:"a,maxlen=1"`
+				}{},
+				struct {
+					A map[string]string `config:"a,min=1"`
+				}{},
+			} {
+				_, err := PolicyFromStruct(nil, v)
+				So(err, ShouldNotBeNil)
+			}
+		})
+		Convey("invalid structs", func() {
+			_, err := PolicyFromStruct(nil, 1)
+			So(err, ShouldNotBeNil)
+			_, err = PolicyFromStruct(nil, struct {
+				A string `config:"a,min=1"`
+			}{})
+			So(err, ShouldNotBeNil)
+			_, err = PolicyFromStruct(nil, struct {
+				A int `config:"a,default=x"`
+			}{})
+			So(err, ShouldNotBeNil)
+			_, err = PolicyFromStruct(nil, struct {
+				A []int `config:"a"`
+			}{})
+			So(err, ShouldNotBeNil)
+			_, err = PolicyFromStruct(nil, struct {
+				A int `config:"a,optional"`
+			}{})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestConfigDecode(t *testing.T) {
+	Convey("Test decoding config into a struct", t, func() {
+		Convey("values and defaults", func() {
+			var sc structConfig
+			err := Config{"host": "localhost", "port": int64(9000), "ratio": 0.5, "Retries": "5"}.Decode(&sc)
+			So(err, ShouldBeNil)
+			So(sc, ShouldResemble, structConfig{Host: "localhost", Port: 9000, Ratio: 0.5, Retries: 5})
+		})
+		Convey("values from JSON config", func() {
+			var sc structConfig
+			err := Config{"host": "h", "port": float64(80), "debug": "true"}.Decode(&sc)
+			So(err, ShouldBeNil)
+			So(sc.Port, ShouldEqual, 80)
+			So(sc.Debug, ShouldBeTrue)
+			So(sc.Retries, ShouldEqual, 3)
+		})
+		Convey("missing required value", func() {
+			var sc structConfig
+			err := Config{}.Decode(&sc)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, ErrConfigNotFound.Error())
+		})
+		Convey("values which cannot be converted", func() {
+			var sc structConfig
+			So(Config{"host": 1}.Decode(&sc), ShouldNotBeNil)
+			So(Config{"host": "h", "port": int64(70000)}.Decode(&sc), ShouldNotBeNil)
+			So(Config{"host": "h", "port": 1.5}.Decode(&sc), ShouldNotBeNil)
+			So(Config{"host": "h", "debug": 1}.Decode(&sc), ShouldNotBeNil)
+		})
+		Convey("durations, lists and maps", func() {
+			var v struct {
+				Interval time.Duration     `config:"interval,default=1m,min=1s"`
+				Hosts    []string          `config:"hosts,default=a|b"`
+				Headers  map[string]string `config:"headers,default=x=1|y=2"`
+			}
+			cp, err := PolicyFromStruct([]string{"a"}, &v)
+			So(err, ShouldBeNil)
+			So(cp.stringConstraints["a"]["interval"].format, ShouldEqual, durationFormat)
+			So(cp.stringRules["a"].Rules["headers"].Default, ShouldEqual, "x=1,y=2")
+
+			So(Config{"interval": "5s"}.Decode(&v), ShouldBeNil)
+			So(v.Interval, ShouldEqual, 5*time.Second)
+			So(v.Hosts, ShouldResemble, []string{"a", "b"})
+			So(v.Headers, ShouldResemble, map[string]string{"x": "1", "y": "2"})
+			So(Config{"interval": "soon"}.Decode(&v), ShouldNotBeNil)
+			So(v.Interval, ShouldEqual, 5*time.Second)
+		})
+		Convey("not a pointer to a struct", func() {
+			So(Config{}.Decode(structConfig{}), ShouldNotBeNil)
+		})
+	})
+}
@@ -23,6 +23,7 @@ package plugin
 
 import (
 	"fmt"
+	"math"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -83,6 +84,69 @@ func TestConfig(t *testing.T) {
 			})
 		}
 	})
+	Convey("Test Config coerces numbers", t, func() {
+		config := Config{
+			"float":    float64(42),
+			"fraction": 4.2,
+			"huge":     1e19,
+			"nan":      math.NaN(),
+			"int":      12,
+			"uint":     uint64(math.MaxUint64),
+			"exact":    int64(1 << 60),
+			"inexact":  int64(1<<60 + 1),
+			"int32":    int32(-7),
+			"float32":  float32(0.5),
+		}
+		Convey("to int64", func() {
+			i, err := config.GetInt("float")
+			So(err, ShouldBeNil)
+			So(i, ShouldEqual, 42)
+			i, err = config.GetInt("int32")
+			So(err, ShouldBeNil)
+			So(i, ShouldEqual, -7)
+			_, err = config.GetInt("fraction")
+			So(err, ShouldEqual, ErrLossyConversion)
+			_, err = config.GetInt("nan")
+			So(err, ShouldEqual, ErrLossyConversion)
+			_, err = config.GetInt("huge")
+			So(err, ShouldEqual, ErrIntOverflow)
+			_, err = config.GetInt("uint")
+			So(err, ShouldEqual, ErrIntOverflow)
+		})
+		Convey("to float64", func() {
+			f, err := config.GetFloat("int")
+			So(err, ShouldBeNil)
+			So(f, ShouldEqual, 12)
+			f, err = config.GetFloat("float32")
+			So(err, ShouldBeNil)
+			So(f, ShouldEqual, 0.5)
+			f, err = config.GetFloat("exact")
+			So(err, ShouldBeNil)
+			So(f, ShouldEqual, float64(1<<60))
+			_, err = config.GetFloat("inexact")
+			So(err, ShouldEqual, ErrLossyConversion)
+			_, err = config.GetFloat("uint")
+			So(err, ShouldEqual, ErrLossyConversion)
+		})
+		Convey("to the types of config policy rules", func() {
+			cp := NewConfigPolicy()
+			cp.AddNewIntRule([]string{"a"}, "port", false)
+			cp.AddNewIntRule([]string{"a"}, "count", false)
+			cp.AddNewIntRule([]string{"a"}, "ratio", false)
+			cp.AddNewFloatRule([]string{"a"}, "limit", false)
+			cp.AddNewIntRule([]string{"a"}, "name", false)
+			cp.AddNewStringRule([]string{"b"}, "name", false)
+			config := Config{"port": float64(8086), "count": " 12 ", "ratio": 0.5, "limit": "1e3", "name": "7"}
+			config.applyNumberRules(*cp)
+			So(config, ShouldResemble, Config{
+				"port":  int64(8086),
+				"count": int64(12),
+				"ratio": 0.5,
+				"limit": float64(1000),
+				"name":  "7",
+			})
+		})
+	})
 	Convey("Test Config applies defaults from config policy", t, func() {
 		// create config policy
 		mockPolicy := NewConfigPolicy()
@@ -198,7 +262,7 @@ func configErrTestCases() []testCaseConfig {
 		},
 		{
 			expected: 12.1,
-			input:    "i",
+			input:    "a",
 		},
 		{
 			expected: "bbb",
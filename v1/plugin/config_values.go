@@ -0,0 +1,410 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Durations, lists and maps are sent to the plugin as strings, so they fit
+// the StringMap of the config snapteld sends:
+//
+//	duration:  the format of time.ParseDuration, e.g. "1m30s"
+//	list:      values separated by commas, e.g. "host1:80,host2:80"
+//	map:       key=value pairs separated by commas, e.g. "a=1,b=2"
+//
+// A comma, equal sign or backslash within a value or key is escaped with a
+// backslash. Spaces around values and keys are ignored, unless escaped with a
+// backslash. EncodeStringSlice and EncodeStringMap produce this encoding.
+// The empty string is the empty list, so a list made of a single empty
+// value cannot be encoded, neither can a map with an empty key.
+//
+// Config read from JSON, e.g. the -config flag of diagnostics, may also hold
+// lists and maps as JSON arrays and objects of strings.
+
+// stringFormat is the encoding expected in the value of a string rule.
+type stringFormat string
+
+const (
+	durationFormat stringFormat = "duration"
+	listFormat     stringFormat = "list"
+	mapFormat      stringFormat = "map"
+)
+
+var configEscaper = strings.NewReplacer(`\`, `\\`, `,`, `\,`, `=`, `\=`)
+
+var (
+	errSingleEmptyValue = errors.New("a list of a single empty value cannot be encoded")
+	errEmptyKey         = errors.New("a map with an empty key cannot be encoded")
+)
+
+// EncodeStringSlice encodes values as a config string read by
+// Config.GetStringSlice. A list made of a single empty value is an error, as
+// it would be read as the empty list.
+func EncodeStringSlice(values []string) (string, error) {
+	if len(values) == 1 && values[0] == "" {
+		return "", errSingleEmptyValue
+	}
+	escaped := make([]string, len(values))
+	for i, v := range values {
+		escaped[i] = escapeConfigValue(v)
+	}
+	return strings.Join(escaped, ","), nil
+}
+
+// EncodeStringMap encodes m as a config string read by Config.GetStringMap.
+// Pairs are sorted by key. An empty key is an error.
+func EncodeStringMap(m map[string]string) (string, error) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		if k == "" {
+			return "", errEmptyKey
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = escapeConfigValue(k) + "=" + escapeConfigValue(m[k])
+	}
+	return strings.Join(pairs, ","), nil
+}
+
+// escapeConfigValue escapes the separators and backslashes of v, and the
+// spaces around it which would be ignored otherwise.
+func escapeConfigValue(v string) string {
+	v = configEscaper.Replace(v)
+	start := 0
+	for start < len(v) && isConfigSpace(v[start]) {
+		start++
+	}
+	end := len(v)
+	for end > start && isConfigSpace(v[end-1]) {
+		end--
+	}
+	if start == 0 && end == len(v) {
+		return v
+	}
+	return escapeSpaces(v[:start]) + v[start:end] + escapeSpaces(v[end:])
+}
+
+func escapeSpaces(s string) string {
+	b := make([]byte, 0, 2*len(s))
+	for i := 0; i < len(s); i++ {
+		b = append(b, '\\', s[i])
+	}
+	return string(b)
+}
+
+func isConfigSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	}
+	return false
+}
+
+// trimConfigSpace trims the spaces around s which are not escaped.
+func trimConfigSpace(s string) string {
+	start := 0
+	for start < len(s) && isConfigSpace(s[start]) {
+		start++
+	}
+	end := start
+	for i := start; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			end = i + 1
+		} else if !isConfigSpace(s[i]) {
+			end = i + 1
+		}
+	}
+	return s[start:end]
+}
+
+// GetDuration takes a given key and checks the config for both that the key
+// exists, and that it is a time.Duration or a string in the format of
+// time.ParseDuration.
+// Returns an error if either of these is false.
+func (c Config) GetDuration(key string) (time.Duration, error) {
+	val, ok := c[key]
+	if !ok {
+		return 0, ErrConfigNotFound
+	}
+	switch v := val.(type) {
+	case time.Duration:
+		return v, nil
+	case string:
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil {
+			return 0, ErrNotADuration
+		}
+		return d, nil
+	}
+	return 0, ErrNotADuration
+}
+
+// GetStringSlice takes a given key and checks the config for both that the
+// key exists, and that it is a []string, a []interface{} of strings as read
+// from JSON, or a string holding a list of comma separated values.
+// Returns an error if either of these is false.
+func (c Config) GetStringSlice(key string) ([]string, error) {
+	val, ok := c[key]
+	if !ok {
+		return nil, ErrConfigNotFound
+	}
+	switch v := val.(type) {
+	case []string:
+		return v, nil
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, ErrNotAStringSlice
+			}
+			values[i] = s
+		}
+		return values, nil
+	case string:
+		values, err := decodeStringSlice(v)
+		if err != nil {
+			return nil, ErrNotAStringSlice
+		}
+		return values, nil
+	}
+	return nil, ErrNotAStringSlice
+}
+
+// GetStringMap takes a given key and checks the config for both that the
+// key exists, and that it is a map[string]string, a map[string]interface{}
+// of strings as read from JSON, or a string holding comma separated
+// key=value pairs.
+// Returns an error if either of these is false.
+func (c Config) GetStringMap(key string) (map[string]string, error) {
+	val, ok := c[key]
+	if !ok {
+		return nil, ErrConfigNotFound
+	}
+	switch v := val.(type) {
+	case map[string]string:
+		return v, nil
+	case map[string]interface{}:
+		m := make(map[string]string, len(v))
+		for k, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, ErrNotAStringMap
+			}
+			m[k] = s
+		}
+		return m, nil
+	case string:
+		m, err := decodeStringMap(v)
+		if err != nil {
+			return nil, ErrNotAStringMap
+		}
+		return m, nil
+	}
+	return nil, ErrNotAStringMap
+}
+
+type durationRuleOpt func(*stringRule)
+
+// SetDefaultDuration Allows easy setting of the Default value for a duration rule.
+// Usage:
+//		AddNewDurationRule(ns, key, req, config.SetDefaultDuration(default))
+func SetDefaultDuration(in time.Duration) durationRuleOpt {
+	return func(i *stringRule) {
+		i.Default = in.String()
+		i.HasDefault = true
+	}
+}
+
+// SetMinDuration Allows easy setting of the Min value for a duration rule.
+// Usage:
+//		AddNewDurationRule(ns, key, req, config.SetMinDuration(min))
+func SetMinDuration(min time.Duration) durationRuleOpt {
+	return func(i *stringRule) {
+		i.minDuration = min
+		i.hasMinDuration = true
+	}
+}
+
+// SetMaxDuration Allows easy setting of the Max value for a duration rule.
+// Usage:
+//		AddNewDurationRule(ns, key, req, config.SetMaxDuration(max))
+func SetMaxDuration(max time.Duration) durationRuleOpt {
+	return func(i *stringRule) {
+		i.maxDuration = max
+		i.hasMaxDuration = true
+	}
+}
+
+type stringSliceRuleOpt func(*stringRule)
+
+// SetDefaultStringSlice Allows easy setting of the Default value for a list rule.
+// Usage:
+//		AddNewStringSliceRule(ns, key, req, config.SetDefaultStringSlice(default...))
+func SetDefaultStringSlice(in ...string) stringSliceRuleOpt {
+	return func(i *stringRule) {
+		i.Default, i.err = EncodeStringSlice(in)
+		i.HasDefault = true
+	}
+}
+
+type stringMapRuleOpt func(*stringRule)
+
+// SetDefaultStringMap Allows easy setting of the Default value for a map rule.
+// Usage:
+//		AddNewStringMapRule(ns, key, req, config.SetDefaultStringMap(default))
+func SetDefaultStringMap(in map[string]string) stringMapRuleOpt {
+	return func(i *stringRule) {
+		i.Default, i.err = EncodeStringMap(in)
+		i.HasDefault = true
+	}
+}
+
+// AddNewDurationRule adds a new rule for a duration, read with
+// Config.GetDuration. It is sent to snapteld as a string rule.
+// The required arguments are ns([]string), key(string), req(bool)
+// and optionally:
+//		plugin.SetDefaultDuration(time.Duration),
+//		plugin.SetMinDuration(time.Duration),
+//		plugin.SetMaxDuration(time.Duration)
+func (c *ConfigPolicy) AddNewDurationRule(ns []string, key string, req bool, opts ...durationRuleOpt) error {
+	sopts := []stringRuleOpt{withStringFormat(durationFormat)}
+	for _, opt := range opts {
+		sopts = append(sopts, stringRuleOpt(opt))
+	}
+	return c.AddNewStringRule(ns, key, req, sopts...)
+}
+
+// AddNewStringSliceRule adds a new rule for a list of strings, read with
+// Config.GetStringSlice. It is sent to snapteld as a string rule.
+// The required arguments are ns([]string), key(string), req(bool)
+// and optionally:
+//		plugin.SetDefaultStringSlice(...string)
+func (c *ConfigPolicy) AddNewStringSliceRule(ns []string, key string, req bool, opts ...stringSliceRuleOpt) error {
+	sopts := []stringRuleOpt{withStringFormat(listFormat)}
+	for _, opt := range opts {
+		sopts = append(sopts, stringRuleOpt(opt))
+	}
+	return c.AddNewStringRule(ns, key, req, sopts...)
+}
+
+// AddNewStringMapRule adds a new rule for a map of strings, read with
+// Config.GetStringMap. It is sent to snapteld as a string rule.
+// The required arguments are ns([]string), key(string), req(bool)
+// and optionally:
+//		plugin.SetDefaultStringMap(map[string]string)
+func (c *ConfigPolicy) AddNewStringMapRule(ns []string, key string, req bool, opts ...stringMapRuleOpt) error {
+	sopts := []stringRuleOpt{withStringFormat(mapFormat)}
+	for _, opt := range opts {
+		sopts = append(sopts, stringRuleOpt(opt))
+	}
+	return c.AddNewStringRule(ns, key, req, sopts...)
+}
+
+func withStringFormat(f stringFormat) stringRuleOpt {
+	return func(i *stringRule) {
+		i.format = f
+	}
+}
+
+var errTrailingBackslash = errors.New("trailing backslash")
+
+// splitEscaped splits s at each sep which is not escaped by a backslash,
+// keeping the escapes in the parts. At most n parts are returned if n > 0.
+func splitEscaped(s string, sep byte, n int) ([]string, error) {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 == len(s) {
+				return nil, errTrailingBackslash
+			}
+			i++
+		case sep:
+			if n > 0 && len(parts) == n-1 {
+				continue
+			}
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:]), nil
+}
+
+// unescape removes the backslashes escaping characters of s.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
+}
+
+func decodeStringSlice(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return []string{}, nil
+	}
+	parts, err := splitEscaped(s, ',', 0)
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range parts {
+		parts[i] = unescape(trimConfigSpace(p))
+	}
+	return parts, nil
+}
+
+func decodeStringMap(s string) (map[string]string, error) {
+	m := map[string]string{}
+	if strings.TrimSpace(s) == "" {
+		return m, nil
+	}
+	pairs, err := splitEscaped(s, ',', 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, pair := range pairs {
+		kv, err := splitEscaped(pair, '=', 2)
+		if err != nil {
+			return nil, err
+		}
+		key := unescape(trimConfigSpace(kv[0]))
+		if len(kv) != 2 || key == "" {
+			return nil, errors.New("expected key=value")
+		}
+		m[key] = unescape(trimConfigSpace(kv[1]))
+	}
+	return m, nil
+}
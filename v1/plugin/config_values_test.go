@@ -0,0 +1,155 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConfigValues(t *testing.T) {
+	Convey("Test duration, list and map config values", t, func() {
+		config := Config{
+			"duration": "1m30s",
+			"hosts":    `a:80, b:80,c\,d`,
+			"headers":  `Accept=text/plain,X-Token=abc\=\=`,
+			"empty":    "",
+			"bad":      `a\`,
+			"int":      int64(1),
+		}
+
+		Convey("durations", func() {
+			d, err := config.GetDuration("duration")
+			So(err, ShouldBeNil)
+			So(d, ShouldEqual, 90*time.Second)
+			_, err = config.GetDuration("hosts")
+			So(err, ShouldEqual, ErrNotADuration)
+			_, err = config.GetDuration("int")
+			So(err, ShouldEqual, ErrNotADuration)
+			_, err = config.GetDuration("missing")
+			So(err, ShouldEqual, ErrConfigNotFound)
+		})
+		Convey("lists", func() {
+			hosts, err := config.GetStringSlice("hosts")
+			So(err, ShouldBeNil)
+			So(hosts, ShouldResemble, []string{"a:80", "b:80", "c,d"})
+			empty, err := config.GetStringSlice("empty")
+			So(err, ShouldBeNil)
+			So(empty, ShouldBeEmpty)
+			_, err = config.GetStringSlice("bad")
+			So(err, ShouldEqual, ErrNotAStringSlice)
+		})
+		Convey("maps", func() {
+			headers, err := config.GetStringMap("headers")
+			So(err, ShouldBeNil)
+			So(headers, ShouldResemble, map[string]string{"Accept": "text/plain", "X-Token": "abc=="})
+			_, err = config.GetStringMap("hosts")
+			So(err, ShouldEqual, ErrNotAStringMap)
+		})
+		Convey("JSON arrays and objects", func() {
+			config := Config{
+				"hosts":   []interface{}{"a:80", "b:80"},
+				"headers": map[string]interface{}{"Accept": "text/plain"},
+				"numbers": []interface{}{1.0},
+			}
+			hosts, err := config.GetStringSlice("hosts")
+			So(err, ShouldBeNil)
+			So(hosts, ShouldResemble, []string{"a:80", "b:80"})
+			headers, err := config.GetStringMap("headers")
+			So(err, ShouldBeNil)
+			So(headers, ShouldResemble, map[string]string{"Accept": "text/plain"})
+			_, err = config.GetStringSlice("numbers")
+			So(err, ShouldEqual, ErrNotAStringSlice)
+		})
+		Convey("encoding should round trip", func() {
+			for _, values := range [][]string{
+				{`a,b`, `c=d`, `e\f`},
+				{" a ", "\tb", `c\ `, " "},
+				{"", ""},
+				{"", "x"},
+				{},
+			} {
+				encoded, err := EncodeStringSlice(values)
+				So(err, ShouldBeNil)
+				decoded, err := Config{"k": encoded}.GetStringSlice("k")
+				So(err, ShouldBeNil)
+				So(decoded, ShouldResemble, values)
+			}
+
+			m := map[string]string{"a=b": "c,d", "e": `f\`, " g": "h "}
+			encoded, err := EncodeStringMap(m)
+			So(err, ShouldBeNil)
+			So(encoded, ShouldEqual, `\ g=h\ ,a\=b=c\,d,e=f\\`)
+			decodedMap, err := Config{"k": encoded}.GetStringMap("k")
+			So(err, ShouldBeNil)
+			So(decodedMap, ShouldResemble, m)
+		})
+		Convey("values which cannot round trip should be rejected", func() {
+			_, err := EncodeStringSlice([]string{""})
+			So(err, ShouldNotBeNil)
+			_, err = EncodeStringMap(map[string]string{"": "a"})
+			So(err, ShouldNotBeNil)
+			So(NewConfigPolicy().AddNewStringSliceRule([]string{"a"}, "hosts", false, SetDefaultStringSlice("")), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestConfigValueRules(t *testing.T) {
+	Convey("Test duration, list and map rules", t, func() {
+		cp := NewConfigPolicy()
+		So(cp.AddNewDurationRule([]string{"a"}, "interval", false, SetDefaultDuration(time.Minute), SetMinDuration(time.Second)), ShouldBeNil)
+		So(cp.AddNewStringSliceRule([]string{"a"}, "hosts", false, SetDefaultStringSlice("a", "b,c")), ShouldBeNil)
+		So(cp.AddNewStringMapRule([]string{"a"}, "headers", true), ShouldBeNil)
+
+		Convey("rules should be sent as string rules with encoded defaults", func() {
+			rules := newGetConfigPolicyReply(*cp).StringPolicy["a"].Rules
+			So(rules["interval"].Default, ShouldEqual, "1m0s")
+			So(rules["hosts"].Default, ShouldEqual, `a,b\,c`)
+			So(rules["headers"].Required, ShouldBeTrue)
+		})
+		Convey("defaults should be readable", func() {
+			config := NewConfig()
+			config.applyDefaults(*cp)
+			d, err := config.GetDuration("interval")
+			So(err, ShouldBeNil)
+			So(d, ShouldEqual, time.Minute)
+			hosts, err := config.GetStringSlice("hosts")
+			So(err, ShouldBeNil)
+			So(hosts, ShouldResemble, []string{"a", "b,c"})
+		})
+		Convey("JSON arrays and objects should be valid", func() {
+			So(cp.Validate(Config{"hosts": []interface{}{"a"}, "headers": map[string]interface{}{"a": "1"}}), ShouldBeEmpty)
+			So(cp.Validate(Config{"headers": []interface{}{"a"}}), ShouldHaveLength, 1)
+		})
+		Convey("values should be validated", func() {
+			errs := cp.Validate(Config{"interval": "10ms", "hosts": `a\`, "headers": "x"})
+			So(errs, ShouldHaveLength, 3)
+			So(errs[0].(*ConfigError).Key, ShouldEqual, "headers")
+			So(errs[0].(*ConfigError).Rule, ShouldEqual, "type")
+			So(errs[1].(*ConfigError).Rule, ShouldEqual, "type")
+			So(errs[2].(*ConfigError).Rule, ShouldEqual, "minimum")
+			So(cp.Validate(Config{"interval": "2s", "headers": "a=1"}), ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,131 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import "context"
+
+// ContextCollector is a Collector whose CollectMetrics is given the context
+// of the call from Snap. The context is done when Snap cancels the call or
+// its deadline passes, and holds the gRPC metadata sent by Snap and the task
+// the call is made for, see TaskFromContext. Start it with
+// StartContextCollector.
+type ContextCollector interface {
+	Plugin
+
+	GetMetricTypes(Config) ([]Metric, error)
+	CollectMetrics(context.Context, []Metric) ([]Metric, error)
+}
+
+// ContextProcessor is a Processor whose Process is given the context of the
+// call from Snap, see ContextCollector. Start it with StartContextProcessor.
+type ContextProcessor interface {
+	Plugin
+
+	Process(context.Context, []Metric, Config) ([]Metric, error)
+}
+
+// ContextPublisher is a Publisher whose Publish is given the context of the
+// call from Snap, see ContextCollector. Start it with StartContextPublisher.
+type ContextPublisher interface {
+	Plugin
+
+	Publish(context.Context, []Metric, Config) error
+}
+
+// contextCollector adapts a ContextCollector to a Collector. The proxy calls
+// the ContextCollector with the context of the call, other callers like the
+// diagnostics get a background context.
+type contextCollector struct {
+	ContextCollector
+}
+
+func (c contextCollector) CollectMetrics(mts []Metric) ([]Metric, error) {
+	return c.ContextCollector.CollectMetrics(context.Background(), mts)
+}
+
+// contextProcessor adapts a ContextProcessor to a Processor.
+type contextProcessor struct {
+	ContextProcessor
+}
+
+func (p contextProcessor) Process(mts []Metric, cfg Config) ([]Metric, error) {
+	return p.ContextProcessor.Process(context.Background(), mts, cfg)
+}
+
+// contextPublisher adapts a ContextPublisher to a Publisher.
+type contextPublisher struct {
+	ContextPublisher
+}
+
+func (p contextPublisher) Publish(mts []Metric, cfg Config) error {
+	return p.ContextPublisher.Publish(context.Background(), mts, cfg)
+}
+
+// withoutContext adapts the context-aware plugin types to the plain ones
+// and returns other plugins unchanged.
+func withoutContext(plugin Plugin) Plugin {
+	switch plugin := plugin.(type) {
+	case ContextCollector:
+		return contextCollector{plugin}
+	case ContextProcessor:
+		return contextProcessor{plugin}
+	case ContextPublisher:
+		return contextPublisher{plugin}
+	}
+	return plugin
+}
+
+// unwrapPlugin returns the plugin adapted by withoutContext, e.g. to look
+// for the optional interfaces it implements.
+func unwrapPlugin(plugin Plugin) Plugin {
+	switch plugin := plugin.(type) {
+	case contextCollector:
+		return plugin.ContextCollector
+	case contextProcessor:
+		return plugin.ContextProcessor
+	case contextPublisher:
+		return plugin.ContextPublisher
+	}
+	return plugin
+}
+
+// collectMetrics calls the collector with ctx if it is context-aware.
+func collectMetrics(ctx context.Context, c Collector, mts []Metric) ([]Metric, error) {
+	if cc, ok := c.(contextCollector); ok {
+		return cc.ContextCollector.CollectMetrics(ctx, mts)
+	}
+	return c.CollectMetrics(mts)
+}
+
+// process calls the processor with ctx if it is context-aware.
+func process(ctx context.Context, p Processor, mts []Metric, cfg Config) ([]Metric, error) {
+	if cp, ok := p.(contextProcessor); ok {
+		return cp.ContextProcessor.Process(ctx, mts, cfg)
+	}
+	return p.Process(mts, cfg)
+}
+
+// publish calls the publisher with ctx if it is context-aware.
+func publish(ctx context.Context, p Publisher, mts []Metric, cfg Config) error {
+	if cp, ok := p.(contextPublisher); ok {
+		return cp.ContextPublisher.Publish(ctx, mts, cfg)
+	}
+	return p.Publish(mts, cfg)
+}
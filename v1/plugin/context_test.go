@@ -0,0 +1,135 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin/rpc"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type mockContextCollector struct {
+	mockPlugin
+	ctx context.Context
+}
+
+func (mc *mockContextCollector) GetMetricTypes(Config) ([]Metric, error) {
+	return []Metric{{Namespace: NewNamespace("a")}}, nil
+}
+
+func (mc *mockContextCollector) CollectMetrics(ctx context.Context, mts []Metric) ([]Metric, error) {
+	mc.ctx = ctx
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	return []Metric{{Namespace: NewNamespace("a"), Data: 1}}, nil
+}
+
+type mockContextProcessor struct {
+	mockPlugin
+	ctx context.Context
+}
+
+func (mp *mockContextProcessor) Process(ctx context.Context, mts []Metric, cfg Config) ([]Metric, error) {
+	mp.ctx = ctx
+	return mts, nil
+}
+
+type mockContextPublisher struct {
+	mockPlugin
+	ctx context.Context
+}
+
+func (mp *mockContextPublisher) Publish(ctx context.Context, mts []Metric, cfg Config) error {
+	mp.ctx = ctx
+	return ctx.Err()
+}
+
+func TestContextPlugins(t *testing.T) {
+	Convey("Test context-aware plugins", t, func() {
+		deadline := time.Now().Add(time.Minute)
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("task-id", "1234"))
+
+		taskID := func(ctx context.Context) string {
+			md, _ := metadata.FromIncomingContext(ctx)
+			return md["task-id"][0]
+		}
+
+		Convey("collectors should get the context of the call", func() {
+			mc := &mockContextCollector{}
+			plugin, ok := withoutContext(mc).(Collector)
+			So(ok, ShouldBeTrue)
+			cp := collectorProxy{pluginProxy: *newPluginProxy(plugin), plugin: plugin}
+			reply, err := cp.CollectMetrics(ctx, &rpc.MetricsArg{})
+			So(err, ShouldBeNil)
+			So(reply.Metrics, ShouldHaveLength, 1)
+			d, ok := mc.ctx.Deadline()
+			So(ok, ShouldBeTrue)
+			So(d, ShouldResemble, deadline)
+			So(taskID(mc.ctx), ShouldEqual, "1234")
+
+			Convey("and see it cancelled", func() {
+				cancel()
+				_, err := cp.CollectMetrics(ctx, &rpc.MetricsArg{})
+				So(err, ShouldEqual, context.Canceled)
+			})
+			Convey("while other callers get a background context", func() {
+				_, err := plugin.CollectMetrics(nil)
+				So(err, ShouldBeNil)
+				So(mc.ctx.Done(), ShouldBeNil)
+			})
+		})
+		Convey("processors should get the context of the call", func() {
+			mp := &mockContextProcessor{}
+			plugin, ok := withoutContext(mp).(Processor)
+			So(ok, ShouldBeTrue)
+			pp := processorProxy{pluginProxy: *newPluginProxy(plugin), plugin: plugin}
+			_, err := pp.Process(ctx, &rpc.PubProcArg{})
+			So(err, ShouldBeNil)
+			So(taskID(mp.ctx), ShouldEqual, "1234")
+		})
+		Convey("publishers should get the context of the call", func() {
+			mp := &mockContextPublisher{}
+			plugin, ok := withoutContext(mp).(Publisher)
+			So(ok, ShouldBeTrue)
+			pp := publisherProxy{pluginProxy: *newPluginProxy(plugin), plugin: plugin}
+			cancel()
+			reply, err := pp.Publish(ctx, &rpc.PubProcArg{})
+			So(err, ShouldBeNil)
+			So(reply.Error, ShouldEqual, context.Canceled.Error())
+			So(taskID(mp.ctx), ShouldEqual, "1234")
+		})
+		Convey("plain plugins should not be adapted", func() {
+			mc := newMockCollector()
+			So(withoutContext(mc), ShouldEqual, mc)
+		})
+	})
+}
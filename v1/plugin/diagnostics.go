@@ -0,0 +1,518 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// sampleMetric is the JSON form of a metric given to diagnostics through the
+// -metrics or -metrics-file flags, e.g.:
+//
+//	[{"namespace": ["intel", "cpu", "0"], "data": 42, "tags": {"host": "a"}}]
+type sampleMetric struct {
+	Namespace   []string          `json:"namespace"`
+	Data        interface{}       `json:"data"`
+	Tags        map[string]string `json:"tags"`
+	Unit        string            `json:"unit"`
+	Description string            `json:"description"`
+	Version     int64             `json:"version"`
+}
+
+// readSampleMetrics returns the metrics given to diagnostics on the command
+// line.
+func readSampleMetrics(c *cli.Context) ([]Metric, error) {
+	var (
+		raw []byte
+		err error
+	)
+	switch {
+	case c.IsSet("metrics-file"):
+		if path := c.String("metrics-file"); path == "-" {
+			raw, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			raw, err = ioutil.ReadFile(path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("! Unable to read sample metrics: \n%v", err)
+		}
+	case c.IsSet("metrics"):
+		raw = []byte(c.String("metrics"))
+	default:
+		return nil, fmt.Errorf("! Please provide sample metrics in form of: -metrics '[{\"namespace\": [\"intel\", \"cpu\"], \"data\": 1}]' or -metrics-file <path>\n")
+	}
+	return parseSampleMetrics(raw)
+}
+
+// parseSampleMetrics decodes a JSON array of sample metrics. Integral numbers
+// are decoded as int64, all other numbers as float64.
+func parseSampleMetrics(raw []byte) ([]Metric, error) {
+	var samples []sampleMetric
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&samples); err != nil {
+		return nil, fmt.Errorf("! Unable to parse sample metrics: \n%v", err)
+	}
+	mts := make([]Metric, 0, len(samples))
+	now := time.Now()
+	for _, s := range samples {
+		if len(s.Namespace) == 0 {
+			return nil, fmt.Errorf("! Sample metric is missing its namespace")
+		}
+		data := s.Data
+		if n, ok := data.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				data = i
+			} else if f, err := n.Float64(); err == nil {
+				data = f
+			}
+		}
+		mts = append(mts, Metric{
+			Namespace:   NewNamespace(s.Namespace...),
+			Version:     s.Version,
+			Config:      Config{},
+			Data:        data,
+			Tags:        s.Tags,
+			Timestamp:   now,
+			Unit:        s.Unit,
+			Description: s.Description,
+		})
+	}
+	return mts, nil
+}
+
+func showProcessorDiagnostics(m meta, p *pluginProxy, c Config, mts []Metric) error {
+	defer timeTrack(time.Now(), "showProcessorDiagnostics")
+	printRuntimeDetails(m)
+	err := printConfigPolicy(p, c)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Metrics before processing: ")
+	printMetricsTable(mts)
+	err = printProcessMetrics(p, mts, c)
+	if err != nil {
+		return err
+	}
+	printContactUs()
+	return nil
+}
+
+func printProcessMetrics(p *pluginProxy, mts []Metric, conf Config) error {
+	defer timeTrack(time.Now(), "printProcessMetrics")
+	processed, err := p.plugin.(Processor).Process(mts, conf)
+	if err != nil {
+		return fmt.Errorf("! Error in the call to Process: \n%v", err)
+	}
+	fmt.Println("Metrics after processing: ")
+	printMetricsTable(processed)
+	return nil
+}
+
+func showPublisherDiagnostics(m meta, p *pluginProxy, c Config, mts []Metric, sinkKey string) error {
+	defer timeTrack(time.Now(), "showPublisherDiagnostics")
+	printRuntimeDetails(m)
+
+	var sink *dryRunSink
+	if sinkKey != "" {
+		var err error
+		if sink, err = startDryRunSink(); err != nil {
+			return fmt.Errorf("! Unable to start dry-run sink: \n%v", err)
+		}
+		c[sinkKey] = sink.endpoint(c[sinkKey])
+		fmt.Printf("Dry-run sink listening, config %q set to %v \n\n", sinkKey, c[sinkKey])
+	}
+
+	err := printConfigPolicy(p, c)
+	if err == nil {
+		err = printConfigValidation(p, c)
+	}
+	if err == nil {
+		fmt.Println("Metrics to publish: ")
+		printMetricsTable(mts)
+		err = printPublishMetrics(p, mts, c)
+	}
+	if sink != nil {
+		sink.printSummary()
+	}
+	if err != nil {
+		return err
+	}
+	printContactUs()
+	return nil
+}
+
+// printConfigValidation reports every config value violating the plugin's
+// config policy.
+func printConfigValidation(p *pluginProxy, conf Config) error {
+	defer timeTrack(time.Now(), "printConfigValidation")
+	cPolicy, err := p.plugin.GetConfigPolicy()
+	if err != nil {
+		return err
+	}
+	errs := cPolicy.Validate(conf)
+	if len(errs) == 0 {
+		fmt.Println("Config is valid against config policy")
+		fmt.Println()
+		return nil
+	}
+	msg := ""
+	for _, e := range errs {
+		msg += fmt.Sprintf("! Warning: %v \n", e)
+	}
+	return fmt.Errorf(msg)
+}
+
+func printPublishMetrics(p *pluginProxy, mts []Metric, conf Config) error {
+	defer timeTrack(time.Now(), "printPublishMetrics")
+	start := time.Now()
+	err := p.plugin.(Publisher).Publish(mts, conf)
+	latency := time.Since(start)
+	if err != nil {
+		return fmt.Errorf("! Error in the call to Publish after %v: \n%v", latency, err)
+	}
+	fmt.Printf("Published %d metrics successfully in %v \n", len(mts), latency)
+	return nil
+}
+
+// streamStopTimeout is how long streaming collector diagnostics wait for
+// StreamMetrics to return once its context is cancelled.
+var streamStopTimeout = 5 * time.Second
+
+func showStreamDiagnostics(m meta, p *pluginProxy, c Config, maxMetricsBuffer int64, maxCollectDuration, runFor time.Duration, maxCount int) error {
+	defer timeTrack(time.Now(), "showStreamDiagnostics")
+	printRuntimeDetails(m)
+	err := printConfigPolicy(p, c)
+	if err != nil {
+		return err
+	}
+
+	met, err := printStreamMetricTypes(p, c)
+	if err != nil {
+		return err
+	}
+	err = printStreamMetrics(p, met, maxMetricsBuffer, maxCollectDuration, runFor, maxCount)
+	if err != nil {
+		return err
+	}
+	printContactUs()
+	return nil
+}
+
+func printStreamMetricTypes(p *pluginProxy, conf Config) ([]Metric, error) {
+	defer timeTrack(time.Now(), "printStreamMetricTypes")
+	met, err := p.plugin.(StreamCollector).GetMetricTypes(conf)
+	if err != nil {
+		return nil, fmt.Errorf("! Error in the call to GetMetricTypes: \n%v", err)
+	}
+	for i := range met {
+		met[i].Config = conf
+	}
+
+	fmt.Println("Metric catalog will be updated to include: ")
+	for _, j := range met {
+		fmt.Printf("    Namespace: %v \n", j.Namespace.String())
+	}
+	printCatalogWarnings(met)
+	return met, nil
+}
+
+// printCatalogWarnings prints the problems found in the metric catalog,
+// which make the plugin fail to load with ValidateCatalog.
+func printCatalogWarnings(mts []Metric) {
+	for _, err := range validateCatalog(mts) {
+		fmt.Printf("! Warning: %v \n", err)
+	}
+}
+
+// printStreamMetrics streams the given metrics from the plugin for runFor or
+// until maxCount metrics were received, batching them the way the stream
+// proxy does before sending them to snapteld. It then cancels the stream and
+// reports whether the plugin returned cleanly.
+func printStreamMetrics(p *pluginProxy, mts []Metric, maxMetricsBuffer int64, maxCollectDuration, runFor time.Duration, maxCount int) error {
+	defer timeTrack(time.Now(), "printStreamMetrics")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan []Metric)
+	out := make(chan []Metric)
+	errs := make(chan string)
+	done := make(chan error, 1)
+	go func() {
+		done <- p.plugin.(StreamCollector).StreamMetrics(ctx, in, out, errs)
+	}()
+	go func() {
+		select {
+		case in <- mts:
+		case <-ctx.Done():
+		}
+	}()
+
+	fmt.Printf("Streaming metrics for %v (max-metrics-buffer: %d, max-collect-duration: %v): \n", runFor, maxMetricsBuffer, maxCollectDuration)
+	var (
+		start    = time.Now()
+		buffer   []Metric
+		batches  int
+		received int
+		returned bool
+		retErr   error
+	)
+	afterCollectDuration := time.After(maxCollectDuration)
+	flush := func(reason string) {
+		afterCollectDuration = time.After(maxCollectDuration)
+		if len(buffer) == 0 {
+			return
+		}
+		batches++
+		fmt.Printf("    Batch %d after %v: %d metrics (%s) \n", batches, time.Since(start), len(buffer), reason)
+		buffer = nil
+	}
+	deadline := time.After(runFor)
+loop:
+	for {
+		select {
+		case got := <-out:
+			for _, mt := range got {
+				buffer = append(buffer, mt)
+				received++
+				if maxMetricsBuffer == int64(len(buffer)) {
+					flush("max-metrics-buffer reached")
+				}
+			}
+			if maxMetricsBuffer == 0 {
+				flush("sent immediately")
+			}
+			if maxCount > 0 && received >= maxCount {
+				break loop
+			}
+		case e := <-errs:
+			fmt.Printf("! Error reported by plugin: %v \n", e)
+		case <-afterCollectDuration:
+			flush("max-collect-duration reached")
+		case retErr = <-done:
+			returned = true
+			break loop
+		case <-deadline:
+			break loop
+		}
+	}
+	flush("end of diagnostics")
+	fmt.Printf("Received %d metrics in %d batches \n\n", received, batches)
+
+	if returned {
+		if retErr != nil {
+			return fmt.Errorf("! Error in the call to StreamMetrics: \n%v", retErr)
+		}
+		return fmt.Errorf("! StreamMetrics returned before its context was cancelled")
+	}
+	cancel()
+	timeout := time.After(streamStopTimeout)
+	for {
+		select {
+		case <-out:
+		case <-errs:
+		case err := <-done:
+			if err != nil {
+				return fmt.Errorf("! StreamMetrics returned an error after its context was cancelled: \n%v", err)
+			}
+			fmt.Println("StreamMetrics returned cleanly after its context was cancelled")
+			return nil
+		case <-timeout:
+			return fmt.Errorf("! StreamMetrics did not return within %v after its context was cancelled", streamStopTimeout)
+		}
+	}
+}
+
+// printMetricsTable prints namespace, type, value and tags of the given
+// metrics.
+func printMetricsTable(mts []Metric) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	printFields(w, true, 4, "NAMESPACE", "TYPE", "VALUE", "TAGS")
+	for _, mt := range mts {
+		printFields(w, true, 4, mt.Namespace.String(), fmt.Sprintf("%T", mt.Data), fmt.Sprintf("%v", mt.Data), formatTags(mt.Tags))
+	}
+	w.Flush()
+	fmt.Println()
+}
+
+// formatTags returns tags as comma separated key=value pairs, sorted by key.
+func formatTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+const (
+	// sinkPeekTimeout bounds the wait of the dry-run sink for the first
+	// bytes of a connection telling whether it is HTTP.
+	sinkPeekTimeout = time.Second
+	// sinkDrainTimeout bounds the wait of the dry-run sink for connections
+	// left open to deliver what was sent on them when it stops.
+	sinkDrainTimeout = 100 * time.Millisecond
+)
+
+// dryRunSink is a local stand-in for the remote endpoint of a publisher. It
+// answers HTTP requests with 204 No Content and discards any other traffic,
+// counting what it receives.
+type dryRunSink struct {
+	lis net.Listener
+	wg  sync.WaitGroup
+
+	mu     sync.Mutex
+	active map[net.Conn]struct{}
+	// drainDeadline is the read deadline of the connections once the sink
+	// is stopping, zero until then.
+	drainDeadline time.Time
+	conns         int
+	requests      int
+	bytes         int64
+}
+
+func startDryRunSink() (*dryRunSink, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &dryRunSink{lis: lis, active: map[net.Conn]struct{}{}}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// endpoint returns the sink's address to be put in place of the given
+// config value. If the value is a URL only its host is replaced, so the
+// scheme and path the publisher expects are kept.
+func (s *dryRunSink) endpoint(current interface{}) string {
+	addr := s.lis.Addr().String()
+	if str, ok := current.(string); ok && strings.Contains(str, "://") {
+		if u, err := url.Parse(str); err == nil {
+			u.Host = addr
+			return u.String()
+		}
+	}
+	return addr
+}
+
+func (s *dryRunSink) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.lis.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns++
+		s.active[conn] = struct{}{}
+		if !s.drainDeadline.IsZero() {
+			conn.SetReadDeadline(s.drainDeadline)
+		}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+func (s *dryRunSink) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.active, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	r := bufio.NewReader(conn)
+	// a client sending less than a request line must not hang the sink
+	conn.SetReadDeadline(time.Now().Add(sinkPeekTimeout))
+	isHTTP := isHTTPRequest(r)
+	s.mu.Lock()
+	conn.SetReadDeadline(s.drainDeadline)
+	s.mu.Unlock()
+	if !isHTTP {
+		n, _ := io.Copy(ioutil.Discard, r)
+		s.count(0, n)
+		return
+	}
+	for {
+		req, err := http.ReadRequest(r)
+		if err != nil {
+			return
+		}
+		n, _ := io.Copy(ioutil.Discard, req.Body)
+		req.Body.Close()
+		s.count(1, n)
+		if _, err := io.WriteString(conn, "HTTP/1.1 204 No Content\r\n\r\n"); err != nil {
+			return
+		}
+	}
+}
+
+func (s *dryRunSink) count(requests int, bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests += requests
+	s.bytes += bytes
+}
+
+// printSummary stops the sink, waits for the connections to drain, at most
+// sinkDrainTimeout for those the publisher keeps open, and prints what it
+// received.
+func (s *dryRunSink) printSummary() {
+	s.lis.Close()
+	s.mu.Lock()
+	s.drainDeadline = time.Now().Add(sinkDrainTimeout)
+	for conn := range s.active {
+		conn.SetReadDeadline(s.drainDeadline)
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	fmt.Printf("Dry-run sink received %d bytes over %d connections (%d HTTP requests) \n\n", s.bytes, s.conns, s.requests)
+}
+
+// isHTTPRequest tells whether the buffered stream starts with an HTTP request
+// line.
+func isHTTPRequest(r *bufio.Reader) bool {
+	head, _ := r.Peek(8)
+	for _, method := range []string{"GET ", "POST ", "PUT ", "PATCH ", "DELETE ", "HEAD ", "OPTIONS "} {
+		if strings.HasPrefix(string(head), method) {
+			return true
+		}
+	}
+	return false
+}
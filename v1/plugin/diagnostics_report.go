@@ -0,0 +1,425 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Formats of the diagnostics output selected with the -output flag.
+const (
+	outputText = "text"
+	outputJSON = "json"
+	outputYAML = "yaml"
+)
+
+// diagnosticsReport is the machine-readable form of collector diagnostics.
+// Config policy rules and metrics are sorted, so that reports of different
+// plugin versions can be diffed.
+type diagnosticsReport struct {
+	Runtime       runtimeReport  `json:"runtime"`
+	ConfigPolicy  []ruleReport   `json:"config_policy"`
+	MissingConfig []string       `json:"missing_config,omitempty"`
+	MetricTypes   []metricReport `json:"metric_types"`
+	Metrics       []metricReport `json:"metrics"`
+	CollectErrors []errorReport  `json:"collect_errors,omitempty"`
+	Durations     []phaseReport  `json:"durations"`
+	Error         string         `json:"error,omitempty"`
+}
+
+type runtimeReport struct {
+	Name       string `json:"name"`
+	Version    int    `json:"version"`
+	RPCType    string `json:"rpc_type"`
+	RPCVersion int    `json:"rpc_version"`
+	OS         string `json:"os"`
+	Arch       string `json:"arch"`
+	GoVersion  string `json:"go_version"`
+}
+
+type ruleReport struct {
+	Namespace string      `json:"namespace"`
+	Key       string      `json:"key"`
+	Type      string      `json:"type"`
+	Format    string      `json:"format,omitempty"`
+	Required  bool        `json:"required"`
+	Default   interface{} `json:"default,omitempty"`
+	Minimum   interface{} `json:"minimum,omitempty"`
+	Maximum   interface{} `json:"maximum,omitempty"`
+	Allowed   []string    `json:"allowed,omitempty"`
+	Pattern   string      `json:"pattern,omitempty"`
+	MinLength *int        `json:"min_length,omitempty"`
+	MaxLength *int        `json:"max_length,omitempty"`
+}
+
+type metricReport struct {
+	Namespace   string            `json:"namespace"`
+	Version     int64             `json:"version,omitempty"`
+	Type        string            `json:"type,omitempty"`
+	Value       interface{}       `json:"value,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Unit        string            `json:"unit,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Kind        MetricKind        `json:"kind,omitempty"`
+}
+
+type errorReport struct {
+	Namespace string `json:"namespace"`
+	Error     string `json:"error"`
+}
+
+type phaseReport struct {
+	Phase    string `json:"phase"`
+	Duration string `json:"duration"`
+}
+
+// showStructuredDiagnostics writes the diagnostics of a collector to stdout
+// as a single JSON or YAML document.
+func showStructuredDiagnostics(m meta, p *pluginProxy, c Config, format string) error {
+	r := newDiagnosticsReport(m, p, c)
+	if err := writeReport(os.Stdout, r, format); err != nil {
+		return err
+	}
+	if r.Error != "" {
+		return errors.New(r.Error)
+	}
+	return nil
+}
+
+// newDiagnosticsReport runs the same phases as showDiagnostics, recording
+// their results instead of printing them. The report is returned up to the
+// first failing phase.
+func newDiagnosticsReport(m meta, p *pluginProxy, c Config) *diagnosticsReport {
+	r := &diagnosticsReport{
+		Runtime: runtimeReport{
+			Name:       m.Name,
+			Version:    m.Version,
+			RPCType:    m.RPCType.String(),
+			RPCVersion: m.RPCVersion,
+			OS:         runtime.GOOS,
+			Arch:       runtime.GOARCH,
+			GoVersion:  runtime.Version(),
+		},
+		ConfigPolicy: []ruleReport{},
+		MetricTypes:  []metricReport{},
+		Metrics:      []metricReport{},
+		Durations:    []phaseReport{},
+	}
+	track := func(start time.Time, phase string) {
+		r.Durations = append(r.Durations, phaseReport{Phase: phase, Duration: time.Since(start).String()})
+	}
+
+	start := time.Now()
+	cPolicy, err := p.plugin.GetConfigPolicy()
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.ConfigPolicy, r.MissingConfig = configPolicyReport(cPolicy, c)
+	track(start, "config_policy")
+	if len(r.MissingConfig) > 0 {
+		r.Error = fmt.Sprintf("required config not provided: %v", strings.Join(r.MissingConfig, ", "))
+		return r
+	}
+
+	start = time.Now()
+	met, err := p.plugin.(Collector).GetMetricTypes(c)
+	track(start, "metric_types")
+	if err != nil {
+		r.Error = fmt.Sprintf("error in the call to GetMetricTypes: %v", err)
+		return r
+	}
+	for i := range met {
+		met[i].Config = c
+	}
+	r.MetricTypes = metricsReport(met, false)
+
+	start = time.Now()
+	cltd, err := p.plugin.(Collector).CollectMetrics(met)
+	track(start, "collect_metrics")
+	if perr, ok := asPartialError(err); ok {
+		for _, me := range perr.Errors {
+			r.CollectErrors = append(r.CollectErrors, errorReport{Namespace: me.Namespace.String(), Error: me.Err.Error()})
+		}
+	} else if err != nil {
+		r.Error = fmt.Sprintf("error in the call to CollectMetrics: %v", err)
+		return r
+	}
+	r.Metrics = metricsReport(cltd, true)
+	return r
+}
+
+// configPolicyReport lists the rules of the policy sorted by namespace and
+// key, together with the required keys missing from the config.
+func configPolicyReport(cPolicy ConfigPolicy, conf Config) (rules []ruleReport, missing []string) {
+	rules = []ruleReport{}
+	add := func(rule ruleReport) {
+		rules = append(rules, rule)
+		if _, ok := conf[rule.Key]; rule.Required && !ok {
+			missing = append(missing, rule.Key)
+		}
+	}
+	for ns, policy := range cPolicy.stringRules {
+		for key, r := range policy.Rules {
+			rule := ruleReport{Namespace: ns, Key: key, Type: "string", Required: r.Required}
+			if r.HasDefault {
+				rule.Default = r.Default
+			}
+			if sc := cPolicy.stringConstraints[ns][key]; sc != nil {
+				rule.Format = string(sc.format)
+				if sc.hasMinDuration {
+					rule.Minimum = sc.minDuration.String()
+				}
+				if sc.hasMaxDuration {
+					rule.Maximum = sc.maxDuration.String()
+				}
+				rule.Allowed = sc.allowed
+				rule.Pattern = sc.pattern
+				if sc.hasMinLen {
+					rule.MinLength = &sc.minLength
+				}
+				if sc.hasMaxLen {
+					rule.MaxLength = &sc.maxLength
+				}
+			}
+			add(rule)
+		}
+	}
+	for ns, policy := range cPolicy.integerRules {
+		for key, r := range policy.Rules {
+			rule := ruleReport{Namespace: ns, Key: key, Type: "integer", Required: r.Required}
+			if r.HasDefault {
+				rule.Default = r.Default
+			}
+			if r.HasMin {
+				rule.Minimum = r.Minimum
+			}
+			if r.HasMax {
+				rule.Maximum = r.Maximum
+			}
+			add(rule)
+		}
+	}
+	for ns, policy := range cPolicy.floatRules {
+		for key, r := range policy.Rules {
+			rule := ruleReport{Namespace: ns, Key: key, Type: "float", Required: r.Required}
+			if r.HasDefault {
+				rule.Default = r.Default
+			}
+			if r.HasMin {
+				rule.Minimum = r.Minimum
+			}
+			if r.HasMax {
+				rule.Maximum = r.Maximum
+			}
+			add(rule)
+		}
+	}
+	for ns, policy := range cPolicy.boolRules {
+		for key, r := range policy.Rules {
+			rule := ruleReport{Namespace: ns, Key: key, Type: "bool", Required: r.Required}
+			if r.HasDefault {
+				rule.Default = r.Default
+			}
+			add(rule)
+		}
+	}
+	sort.Sort(ruleReports(rules))
+	sort.Strings(missing)
+	return rules, missing
+}
+
+// metricsReport converts metrics for the report, sorted by namespace and
+// version. Data is only reported if withData is set.
+func metricsReport(mts []Metric, withData bool) []metricReport {
+	reports := make([]metricReport, 0, len(mts))
+	for _, mt := range mts {
+		r := metricReport{
+			Namespace:   mt.Namespace.String(),
+			Version:     mt.Version,
+			Tags:        mt.Tags,
+			Unit:        mt.Unit,
+			Description: mt.Description,
+			Kind:        mt.Kind,
+		}
+		if withData {
+			r.Type = fmt.Sprintf("%T", mt.Data)
+			r.Value = reportValue(mt.Data)
+		}
+		reports = append(reports, r)
+	}
+	sort.Stable(metricReports(reports))
+	return reports
+}
+
+type ruleReports []ruleReport
+
+func (r ruleReports) Len() int      { return len(r) }
+func (r ruleReports) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r ruleReports) Less(i, j int) bool {
+	if r[i].Namespace != r[j].Namespace {
+		return r[i].Namespace < r[j].Namespace
+	}
+	return r[i].Key < r[j].Key
+}
+
+type metricReports []metricReport
+
+func (r metricReports) Len() int      { return len(r) }
+func (r metricReports) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r metricReports) Less(i, j int) bool {
+	if r[i].Namespace != r[j].Namespace {
+		return r[i].Namespace < r[j].Namespace
+	}
+	return r[i].Version < r[j].Version
+}
+
+// reportValue returns the metric data as it can be encoded in the report:
+// floats which are not finite are reported as strings.
+func reportValue(data interface{}) interface{} {
+	switch v := data.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Sprint(v)
+		}
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return fmt.Sprint(v)
+		}
+	}
+	return data
+}
+
+// writeReport encodes the report in the given format.
+func writeReport(w io.Writer, r *diagnosticsReport, format string) error {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case outputYAML:
+		return writeYAML(w, r)
+	}
+	return fmt.Errorf("unsupported diagnostics output format: %v", format)
+}
+
+// writeYAML encodes v as YAML. The value is taken through its JSON encoding,
+// so the json tags of v apply; keys of objects are sorted.
+func writeYAML(w io.Writer, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if isYAMLCollection(doc) {
+		emitYAML(&buf, doc, 0)
+	} else {
+		buf.WriteString(yamlScalar(doc) + "\n")
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+var yamlPlainKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.\-]*$`)
+
+// emitYAML writes a non-empty object or array in block style.
+func emitYAML(buf *bytes.Buffer, v interface{}, indent int) {
+	pad := strings.Repeat(" ", indent)
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			key := k
+			if !yamlPlainKey.MatchString(k) {
+				key = yamlScalar(k)
+			}
+			if isYAMLCollection(v[k]) {
+				buf.WriteString(pad + key + ":\n")
+				emitYAML(buf, v[k], indent+2)
+			} else {
+				buf.WriteString(pad + key + ": " + yamlScalar(v[k]) + "\n")
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if !isYAMLCollection(item) {
+				buf.WriteString(pad + "- " + yamlScalar(item) + "\n")
+				continue
+			}
+			// the first line of a nested collection goes after the dash
+			var nested bytes.Buffer
+			emitYAML(&nested, item, indent+2)
+			buf.WriteString(pad + "- ")
+			buf.Write(nested.Bytes()[indent+2:])
+		}
+	}
+}
+
+// isYAMLCollection tells whether v is an object or array with elements,
+// which are written in block style.
+func isYAMLCollection(v interface{}) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return len(v) > 0
+	case []interface{}:
+		return len(v) > 0
+	}
+	return false
+}
+
+// yamlScalar returns the flow form of a scalar or empty collection. Strings
+// are always double-quoted, which YAML reads the same as JSON does.
+func yamlScalar(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "{}"
+	case []interface{}:
+		return "[]"
+	case json.Number:
+		return v.String()
+	case bool:
+		return fmt.Sprint(v)
+	}
+	raw, _ := json.Marshal(v)
+	return string(raw)
+}
@@ -0,0 +1,129 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDiagnosticsReport(t *testing.T) {
+	Convey("Test building collector diagnostics report", t, func() {
+		m := meta{Name: "mock", Version: 2, RPCType: gRPC, RPCVersion: 1}
+		config := NewConfig()
+		cPolicy, _ := newMockPlugin().GetConfigPolicy()
+		config.applyDefaults(cPolicy)
+
+		Convey("successful run should report all phases", func() {
+			r := newDiagnosticsReport(m, newPluginProxy(newMockCollector()), config)
+			So(r.Error, ShouldBeEmpty)
+			So(r.Runtime.Name, ShouldEqual, "mock")
+			So(r.ConfigPolicy, ShouldHaveLength, 8)
+			So(r.ConfigPolicy[0], ShouldResemble, ruleReport{Namespace: "abc", Key: "cacheTime", Type: "integer", Required: true, Default: int64(50)})
+			So(r.MetricTypes, ShouldHaveLength, 10)
+			So(r.MetricTypes[0].Value, ShouldBeNil)
+			So(r.Metrics, ShouldHaveLength, 10)
+			for i, mt := range r.Metrics {
+				So(mt.Version, ShouldEqual, i)
+				So(mt.Value, ShouldEqual, i)
+			}
+			So(r.Durations, ShouldHaveLength, 3)
+		})
+		Convey("missing required config should stop after config policy", func() {
+			r := newDiagnosticsReport(m, newPluginProxy(newMockCollector()), Config{})
+			So(r.Error, ShouldContainSubstring, "required config not provided")
+			So(r.MissingConfig, ShouldContain, "cacheTime")
+			So(r.MetricTypes, ShouldBeEmpty)
+		})
+		Convey("failing collection should be reported", func() {
+			mc := newMockCollector()
+			mc.doCollectMetrics = func([]Metric) ([]Metric, error) { return nil, errors.New("boom") }
+			r := newDiagnosticsReport(m, newPluginProxy(mc), config)
+			So(r.Error, ShouldContainSubstring, "boom")
+			So(r.MetricTypes, ShouldHaveLength, 10)
+		})
+		Convey("partially failing collection should report the failures", func() {
+			mc := newMockCollector()
+			mc.doCollectMetrics = func([]Metric) ([]Metric, error) {
+				perr := &PartialError{}
+				perr.Add(NewNamespace("temp"), errors.New("no sensor"))
+				return []Metric{{Namespace: NewNamespace("load"), Data: 1}}, perr
+			}
+			r := newDiagnosticsReport(m, newPluginProxy(mc), config)
+			So(r.Error, ShouldBeEmpty)
+			So(r.Metrics, ShouldHaveLength, 1)
+			So(r.CollectErrors, ShouldResemble, []errorReport{{Namespace: "/temp", Error: "no sensor"}})
+		})
+		Convey("report should encode as JSON", func() {
+			var buf bytes.Buffer
+			r := newDiagnosticsReport(m, newPluginProxy(newMockCollector()), config)
+			So(writeReport(&buf, r, outputJSON), ShouldBeNil)
+			var doc map[string]interface{}
+			So(json.Unmarshal(buf.Bytes(), &doc), ShouldBeNil)
+			So(doc["runtime"], ShouldNotBeNil)
+			So(writeReport(&buf, r, "xml"), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestReportValue(t *testing.T) {
+	Convey("Non-finite floats should be reported as strings", t, func() {
+		So(reportValue(math.NaN()), ShouldEqual, "NaN")
+		So(reportValue(float32(math.Inf(1))), ShouldEqual, "+Inf")
+		So(reportValue(1.5), ShouldEqual, 1.5)
+	})
+}
+
+func TestWriteYAML(t *testing.T) {
+	Convey("Test encoding values as YAML", t, func() {
+		var buf bytes.Buffer
+		err := writeYAML(&buf, map[string]interface{}{
+			"name":  "x",
+			"count": 2,
+			"list": []interface{}{
+				map[string]interface{}{"a": 1, "b": []string{"c"}},
+				"d",
+			},
+			"empty": []interface{}{},
+			"tags":  map[string]string{"some key": "v"},
+			"none":  nil,
+		})
+		So(err, ShouldBeNil)
+		So(buf.String(), ShouldEqual, `count: 2
+empty: []
+list:
+  - a: 1
+    b:
+      - "c"
+  - "d"
+name: "x"
+none: null
+tags:
+  "some key": "v"
+`)
+	})
+}
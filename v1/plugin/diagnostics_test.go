@@ -0,0 +1,171 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseSampleMetrics(t *testing.T) {
+	Convey("Test parsing sample metrics for diagnostics", t, func() {
+		Convey("valid sample metrics", func() {
+			mts, err := parseSampleMetrics([]byte(`[
+				{"namespace": ["a", "int"], "data": 42, "tags": {"t": "v"}, "unit": "B"},
+				{"namespace": ["a", "float"], "data": 4.2},
+				{"namespace": ["a", "string"], "data": "x", "version": 2}
+			]`))
+			So(err, ShouldBeNil)
+			So(mts, ShouldHaveLength, 3)
+			So(mts[0].Namespace.String(), ShouldEqual, "/a/int")
+			So(mts[0].Data, ShouldEqual, int64(42))
+			So(mts[0].Tags, ShouldResemble, map[string]string{"t": "v"})
+			So(mts[0].Unit, ShouldEqual, "B")
+			So(mts[1].Data, ShouldEqual, float64(4.2))
+			So(mts[2].Data, ShouldEqual, "x")
+			So(mts[2].Version, ShouldEqual, 2)
+		})
+		Convey("malformed JSON", func() {
+			_, err := parseSampleMetrics([]byte(`{"namespace": ["a"]}`))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("metric without namespace", func() {
+			_, err := parseSampleMetrics([]byte(`[{"data": 1}]`))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestFormatTags(t *testing.T) {
+	Convey("Tags should be formatted sorted by key", t, func() {
+		So(formatTags(map[string]string{"b": "2", "a": "1"}), ShouldEqual, "a=1,b=2")
+		So(formatTags(nil), ShouldEqual, "")
+	})
+}
+
+func TestDryRunSink(t *testing.T) {
+	Convey("Having a dry-run sink", t, func() {
+		sink, err := startDryRunSink()
+		So(err, ShouldBeNil)
+		addr := sink.lis.Addr().String()
+
+		Convey("endpoint should replace host of URLs only", func() {
+			So(sink.endpoint("http://influx:8086/write?db=snap"), ShouldEqual, "http://"+addr+"/write?db=snap")
+			So(sink.endpoint("graphite:2003"), ShouldEqual, addr)
+			So(sink.endpoint(nil), ShouldEqual, addr)
+		})
+		Convey("HTTP requests should be answered", func() {
+			resp, err := http.Post("http://"+addr+"/write", "text/plain", strings.NewReader("payload"))
+			So(err, ShouldBeNil)
+			resp.Body.Close()
+			So(resp.StatusCode, ShouldEqual, http.StatusNoContent)
+			sink.printSummary()
+			So(sink.requests, ShouldEqual, 1)
+			So(sink.bytes, ShouldEqual, len("payload"))
+		})
+		Convey("raw TCP traffic should be drained", func() {
+			conn, err := net.Dial("tcp", addr)
+			So(err, ShouldBeNil)
+			fmt.Fprint(conn, "a.b.c 1 1500000000\n")
+			conn.Close()
+			sink.printSummary()
+			So(sink.conns, ShouldEqual, 1)
+			So(sink.requests, ShouldEqual, 0)
+			So(sink.bytes, ShouldEqual, len("a.b.c 1 1500000000\n"))
+		})
+		Convey("short writes on open connections should be counted", func() {
+			conn, err := net.Dial("tcp", addr)
+			So(err, ShouldBeNil)
+			defer conn.Close()
+			fmt.Fprint(conn, "a 1\n")
+			// the connection must be accepted before the sink stops
+			for accepted := false; !accepted; time.Sleep(time.Millisecond) {
+				sink.mu.Lock()
+				accepted = sink.conns == 1
+				sink.mu.Unlock()
+			}
+			sink.printSummary()
+			So(sink.conns, ShouldEqual, 1)
+			So(sink.requests, ShouldEqual, 0)
+			So(sink.bytes, ShouldEqual, len("a 1\n"))
+		})
+		Reset(func() {
+			sink.lis.Close()
+		})
+	})
+}
+
+type diagStreamer struct {
+	mockStreamer
+	ignoreCancel bool
+}
+
+// StreamMetrics echoes every metric it is asked for one by one, every 10ms.
+func (s *diagStreamer) StreamMetrics(ctx context.Context, in chan []Metric, out chan []Metric, _ chan string) error {
+	var mts []Metric
+	for {
+		select {
+		case mts = <-in:
+		case <-time.After(10 * time.Millisecond):
+			for _, mt := range mts {
+				out <- []Metric{mt}
+			}
+		case <-ctx.Done():
+			if s.ignoreCancel {
+				select {}
+			}
+			return nil
+		}
+	}
+}
+
+func TestPrintStreamMetrics(t *testing.T) {
+	Convey("Test streaming collector diagnostics", t, func() {
+		mts := []Metric{{Namespace: NewNamespace("a", "1")}, {Namespace: NewNamespace("a", "2")}}
+
+		Convey("plugin returning cleanly after cancellation", func() {
+			p := newPluginProxy(&diagStreamer{})
+			err := printStreamMetrics(p, mts, 2, time.Second, time.Second, 4)
+			So(err, ShouldBeNil)
+		})
+		Convey("plugin ignoring cancellation", func() {
+			defer func(d time.Duration) { streamStopTimeout = d }(streamStopTimeout)
+			streamStopTimeout = 50 * time.Millisecond
+			p := newPluginProxy(&diagStreamer{ignoreCancel: true})
+			err := printStreamMetrics(p, mts, 0, time.Second, 100*time.Millisecond, 0)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "did not return")
+		})
+		Convey("plugin returning before cancellation", func() {
+			p := newPluginProxy(newMockErrStreamer())
+			err := printStreamMetrics(p, mts, 0, time.Second, time.Second, 0)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,118 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"math"
+	"sort"
+)
+
+// Histogram is metric data holding the distribution of samples over
+// buckets, like the histograms of Prometheus. Bucket counts are
+// cumulative: each counts the samples less than or equal to its upper
+// bound. The bucket of +Inf is not listed, its count is Count.
+//
+// Histograms are sent as JSON, so samples must be finite numbers.
+type Histogram struct {
+	Count   uint64   `json:"count"`
+	Sum     float64  `json:"sum"`
+	Buckets []Bucket `json:"buckets"`
+}
+
+// Bucket is a bucket of a Histogram.
+type Bucket struct {
+	UpperBound float64 `json:"upper_bound"`
+	Count      uint64  `json:"count"`
+}
+
+// NewHistogram returns a histogram with buckets of the given upper bounds,
+// holding samples.
+func NewHistogram(bounds []float64, samples ...float64) Histogram {
+	sorted := make([]float64, len(bounds))
+	copy(sorted, bounds)
+	sort.Float64s(sorted)
+	h := Histogram{Buckets: make([]Bucket, 0, len(sorted))}
+	for i, b := range sorted {
+		if math.IsInf(b, 1) || (i > 0 && b == sorted[i-1]) {
+			continue
+		}
+		h.Buckets = append(h.Buckets, Bucket{UpperBound: b})
+	}
+	for _, v := range samples {
+		h.Observe(v)
+	}
+	return h
+}
+
+// Observe adds the sample v to the histogram.
+func (h *Histogram) Observe(v float64) {
+	h.Count++
+	h.Sum += v
+	// buckets are sorted, so v is counted by the ones from the first bound >= v
+	i := sort.Search(len(h.Buckets), func(i int) bool { return v <= h.Buckets[i].UpperBound })
+	for ; i < len(h.Buckets); i++ {
+		h.Buckets[i].Count++
+	}
+}
+
+// Summary is metric data holding the count, sum and quantiles of samples,
+// like the summaries of Prometheus.
+//
+// Summaries are sent as JSON, so samples must be finite numbers.
+type Summary struct {
+	Count     uint64     `json:"count"`
+	Sum       float64    `json:"sum"`
+	Quantiles []Quantile `json:"quantiles"`
+}
+
+// Quantile is a quantile of a Summary, e.g. the 0.99 quantile and the value
+// 99% of the samples are less than or equal to.
+type Quantile struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+// NewSummary returns a summary of samples with the given quantiles, which
+// are expected to be between 0 and 1. Quantiles are computed exactly with
+// the nearest-rank method. A summary of no samples has no quantiles.
+func NewSummary(quantiles []float64, samples ...float64) Summary {
+	s := Summary{Count: uint64(len(samples))}
+	if len(samples) == 0 {
+		return s
+	}
+	sorted := make([]float64, len(samples))
+	copy(sorted, samples)
+	sort.Float64s(sorted)
+	for _, v := range sorted {
+		s.Sum += v
+	}
+	s.Quantiles = make([]Quantile, len(quantiles))
+	for i, q := range quantiles {
+		rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		if rank >= len(sorted) {
+			rank = len(sorted) - 1
+		}
+		s.Quantiles[i] = Quantile{Quantile: q, Value: sorted[rank]}
+	}
+	return s
+}
@@ -0,0 +1,78 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHistogram(t *testing.T) {
+	Convey("Test histograms", t, func() {
+		h := NewHistogram([]float64{10, 1, 5, 5}, 0.5, 1, 3, 7, 20)
+		So(h.Count, ShouldEqual, 5)
+		So(h.Sum, ShouldEqual, 31.5)
+		So(h.Buckets, ShouldResemble, []Bucket{
+			{UpperBound: 1, Count: 2},
+			{UpperBound: 5, Count: 3},
+			{UpperBound: 10, Count: 4},
+		})
+		h.Observe(5)
+		So(h.Count, ShouldEqual, 6)
+		So(h.Buckets[1].Count, ShouldEqual, 4)
+
+		Convey("histograms should survive conversion to protobuf", func() {
+			protoMetric, err := toProtoMetric(Metric{Namespace: NewNamespace("a"), Data: &h})
+			So(err, ShouldBeNil)
+			mt := fromProtoMetric(protoMetric)
+			So(mt.Data, ShouldResemble, h)
+			So(mt.Tags, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestSummary(t *testing.T) {
+	Convey("Test summaries", t, func() {
+		samples := []float64{}
+		for i := 100; i > 0; i-- {
+			samples = append(samples, float64(i))
+		}
+		s := NewSummary([]float64{0, 0.5, 0.99, 1}, samples...)
+		So(s.Count, ShouldEqual, 100)
+		So(s.Sum, ShouldEqual, 5050)
+		So(s.Quantiles, ShouldResemble, []Quantile{
+			{Quantile: 0, Value: 1},
+			{Quantile: 0.5, Value: 50},
+			{Quantile: 0.99, Value: 99},
+			{Quantile: 1, Value: 100},
+		})
+		So(samples[0], ShouldEqual, 100)
+		So(NewSummary([]float64{0.5}).Quantiles, ShouldBeEmpty)
+
+		Convey("summaries should survive conversion to protobuf", func() {
+			protoMetric, err := toProtoMetric(Metric{Namespace: NewNamespace("a"), Data: s})
+			So(err, ShouldBeNil)
+			So(fromProtoMetric(protoMetric).Data, ShouldResemble, s)
+		})
+	})
+}
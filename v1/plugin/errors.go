@@ -14,4 +14,15 @@ var (
 	ErrNotAnInt   = fmt.Errorf("config item is not an int64")
 	ErrNotABool   = fmt.Errorf("config item is not a boolean")
 	ErrNotAFloat  = fmt.Errorf("config item is not a float64")
+
+	ErrNotADuration    = fmt.Errorf("config item is not a duration")
+	ErrNotAStringSlice = fmt.Errorf("config item is not a list of strings")
+	ErrNotAStringMap   = fmt.Errorf("config item is not a map of strings")
+
+	// ErrIntOverflow is returned when a number config item is out of the range of int64
+	ErrIntOverflow = fmt.Errorf("config item overflows int64")
+
+	// ErrLossyConversion is returned when a number config item cannot be converted
+	// to the requested type without losing precision
+	ErrLossyConversion = fmt.Errorf("config item cannot be converted without loss of precision")
 )
@@ -3,6 +3,7 @@ package plugin
 import (
 	"fmt"
 	"path/filepath"
+	"time"
 
 	"github.com/urfave/cli"
 )
@@ -19,6 +20,10 @@ var (
 		Name:  "port",
 		Usage: "port GRPC will listen on",
 	}
+	flSocket = cli.StringFlag{
+		Name:  "socket",
+		Usage: "path of a unix domain socket GRPC will listen on instead of TCP",
+	}
 	// ListenAddr the address that GRPC will listen on.  Plugin authors can also
 	// use this address if their plugin binds to a local port as it's sometimes
 	// needed to bind to a public interface.
@@ -73,8 +78,37 @@ var (
 		Destination: &collectDurationStr,
 	}
 
-	flMaxMetricsBuffer = cli.Int64Flag{
-		Name:  "max-metrics-buffer",
-		Usage: "maximum number of metrics the plugin is buffering before sending metrics. Defaults to zero what means send metrics immediately.",
+	flMetrics = cli.StringFlag{
+		Name:  "metrics",
+		Usage: "sample metrics in JSON format used by processor and publisher diagnostics",
+	}
+	flMetricsFile = cli.StringFlag{
+		Name:  "metrics-file",
+		Usage: "path to a file with sample metrics in JSON format used by processor and publisher diagnostics, '-' reads stdin",
+	}
+	flDryRunSink = cli.StringFlag{
+		Name:  "dry-run-sink",
+		Usage: "config key of the endpoint a publisher sends to, pointed at a local sink during diagnostics",
+	}
+	flStreamDuration = cli.DurationFlag{
+		Name:  "stream-duration",
+		Usage: "how long streaming collector diagnostics observe the plugin",
+		Value: 10 * time.Second,
+	}
+	flOutput = cli.StringFlag{
+		Name:  "output",
+		Usage: "format of diagnostics - text, or json and yaml for collectors only",
+		Value: outputText,
+	}
+	flStreamCount = cli.IntFlag{
+		Name:  "stream-count",
+		Usage: "number of metrics after which streaming collector diagnostics stop, 0 means no limit",
+	}
+
+	maxMetricsBufferNum int64 = defaultMaxMetricsBuffer
+	flMaxMetricsBuffer        = cli.Int64Flag{
+		Name:        "max-metrics-buffer",
+		Usage:       "maximum number of metrics the plugin is buffering before sending metrics. Defaults to zero what means send metrics immediately.",
+		Destination: &maxMetricsBufferNum,
 	}
 )
@@ -34,6 +34,8 @@ const (
 
 const defaultConcurrencyCount = 5
 
+const defaultTaskIdleTimeout = 10 * time.Minute
+
 // MetaOpt is used to apply optional metadata on a plugin
 type MetaOpt func(m *meta)
 
@@ -75,6 +77,45 @@ func CacheTTL(t time.Duration) MetaOpt {
 	}
 }
 
+// ValidateConfig == true makes the collector, processor and publisher
+// proxies check the config of each request against the plugin's config
+// policy before calling the plugin. Config breaking the policy is rejected
+// with an InvalidArgument gRPC error naming the namespace, key and broken
+// rule. Collectors are only checked against the policies applying to the
+// namespace of each requested metric. The allowed values, pattern and
+// length constraints of string rules are not known to snapteld and are
+// always checked, whatever ValidateConfig is set to. The config policy is
+// got once when the plugin starts; failing to get it fails every request.
+// ValidateConfig overwrites the default (false).
+func ValidateConfig(v bool) MetaOpt {
+	return func(m *meta) {
+		m.validateConfig = v
+	}
+}
+
+// ValidateCatalog == true makes the collector and streaming collector
+// proxies check the metric types returned by GetMetricTypes, which
+// snapteld asks for when loading the plugin, as CatalogBuilder does. A
+// catalog with problems is rejected with an InvalidArgument gRPC error
+// listing them, so that the plugin fails to load.
+// ValidateCatalog overwrites the default (false).
+func ValidateCatalog(v bool) MetaOpt {
+	return func(m *meta) {
+		m.validateCatalog = v
+	}
+}
+
+// TaskIdleTimeout is the time after the last call for a task after which
+// the task is considered stopped, see TaskStopper. Tasks with a longer
+// interval are stopped and started again between their calls. Tasks are
+// only stopped when the plugin is killed if it is 0.
+// TaskIdleTimeout overwrites the default (10m).
+func TaskIdleTimeout(t time.Duration) MetaOpt {
+	return func(m *meta) {
+		m.taskIdleTimeout = t
+	}
+}
+
 // metaRPCType sets the metaRPCType for the meta object. Used only internally.
 func rpcType(typ metaRPCType) MetaOpt {
 	return func(m *meta) {
@@ -135,6 +176,9 @@ type meta struct {
 	RootCertPaths       string
 
 	grpcServerOptions   []grpc.ServerOption
+	validateConfig      bool
+	validateCatalog     bool
+	taskIdleTimeout     time.Duration
 }
 
 // newMeta sets defaults, applies options, and then returns a meta struct
@@ -144,6 +188,7 @@ func newMeta(plType pluginType, name string, version int, opts ...MetaOpt) *meta
 		Version:          version,
 		Type:             plType,
 		ConcurrencyCount: defaultConcurrencyCount,
+		taskIdleTimeout:  defaultTaskIdleTimeout,
 		RoutingStrategy:  LRURouter,
 		RPCType:          gRPC, // GRPC type
 		RPCVersion:       1,    // This is v1 lib
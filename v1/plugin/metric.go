@@ -20,15 +20,46 @@ limitations under the License.
 package plugin
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin/rpc"
 )
 
-// Metric contains all info related to a Snap Metric
+// Metric contains all info related to a Snap Metric.
+//
+// Data is the value of the metric. It is sent to snapteld as:
+//
+//	string                      string
+//	bool                        bool
+//	[]byte                      bytes
+//	float32                     float32
+//	float64                     float64
+//	int8, int16, int32          int32
+//	int, int64                  int64
+//	uint8, uint16, uint32       uint32
+//	uint, uint64                uint64
+//	time.Time                   int64, nanoseconds since the Unix epoch
+//	time.Duration               int64, nanoseconds
+//	maps, slices and arrays     bytes, encoded as JSON
+//	Histogram, Summary          bytes, encoded as JSON
+//
+// Named types are sent as their underlying type, and types implementing
+// MetricValuer as the value they return. Metrics received by processors
+// and publishers hold string, bool, []byte, float32, float64, int32,
+// int64, uint32 or uint64 data, so time values arrive as int64. Maps,
+// slices and arrays are tagged with ContentTypeTag and arrive decoded as
+// map[string]interface{} or []interface{}, holding int64 for integral
+// JSON numbers and float64 for other numbers. Histograms and summaries,
+// also tagged, arrive as Histogram and Summary values.
+//
+// Kind tells how values of the metric relate to each other over time. It
+// is sent to snapteld as the reserved tag KindTag.
 type Metric struct {
 	Namespace   Namespace
 	Version     int64
@@ -38,10 +69,48 @@ type Metric struct {
 	Timestamp   time.Time
 	Unit        string
 	Description string
+	Kind        MetricKind
 	//Unexported but passed through for legacy reasons
 	lastAdvertisedTime time.Time
 }
 
+const (
+	// ContentTypeTag is the reserved tag holding the encoding of metric
+	// data sent as bytes. It is set and removed by the library for maps,
+	// slices, arrays, histograms and summaries, see Metric.
+	ContentTypeTag = "plugin_content_type"
+
+	// KindTag is the reserved tag holding the Kind of a metric.
+	KindTag = "plugin_metric_kind"
+
+	jsonContentType      = "application/json"
+	histogramContentType = "application/vnd.snap.histogram+json"
+	summaryContentType   = "application/vnd.snap.summary+json"
+)
+
+// MetricKind is the kind of values of a metric.
+type MetricKind string
+
+const (
+	// KindUnknown is the kind of metrics which do not declare one.
+	KindUnknown MetricKind = ""
+	// KindGauge is the kind of metrics whose values can go up and down,
+	// e.g. temperature or memory in use.
+	KindGauge MetricKind = "gauge"
+	// KindCounter is the kind of metrics whose values only go up, except
+	// when the counter is reset, e.g. bytes sent since boot.
+	KindCounter MetricKind = "counter"
+	// KindDelta is the kind of metrics whose values are the change since
+	// the previous value, e.g. bytes sent since the last collection.
+	KindDelta MetricKind = "delta"
+)
+
+// MetricValuer is implemented by types which can be used as metric data by
+// converting themselves to one of the types listed for Metric.Data.
+type MetricValuer interface {
+	MetricValue() (interface{}, error)
+}
+
 // Converts a metric to an protobuf metric.
 // Returns an error in the case where the metric.Data is not one of the
 // supported types.
@@ -71,7 +140,38 @@ func toProtoMetric(mt Metric) (*rpc.Metric, error) {
 			Nsec: int64(mt.lastAdvertisedTime.Nanosecond()),
 		},
 	}
-	switch t := mt.Data.(type) {
+	if err := setProtoData(metric, mt.Data, true); err != nil {
+		return nil, err
+	}
+	if mt.Kind != KindUnknown {
+		metric.Tags = withTag(metric.Tags, KindTag, string(mt.Kind))
+	}
+	return metric, nil
+}
+
+// setProtoData sets the data of the protobuf metric to data, widening it
+// to the nearest supported type. MetricValuers are only used if
+// useValuer is set.
+func setProtoData(metric *rpc.Metric, data interface{}, useValuer bool) error {
+	if data == nil {
+		metric.Data = nil
+		return nil
+	}
+	if v, ok := data.(MetricValuer); ok {
+		if rv := reflect.ValueOf(data); rv.Kind() == reflect.Ptr && rv.IsNil() {
+			metric.Data = nil
+			return nil
+		}
+		if !useValuer {
+			return fmt.Errorf("unsupported type: MetricValue returned %T, which is a MetricValuer", data)
+		}
+		val, err := v.MetricValue()
+		if err != nil {
+			return fmt.Errorf("metric value of %T: %v", data, err)
+		}
+		return setProtoData(metric, val, false)
+	}
+	switch t := data.(type) {
 	case string:
 		metric.Data = &rpc.Metric_StringData{StringData: t}
 	case float64:
@@ -92,14 +192,86 @@ func toProtoMetric(mt Metric) (*rpc.Metric, error) {
 		metric.Data = &rpc.Metric_BytesData{BytesData: t}
 	case bool:
 		metric.Data = &rpc.Metric_BoolData{BoolData: t}
-	case nil:
-		metric.Data = nil
+	case time.Time:
+		metric.Data = &rpc.Metric_Int64Data{Int64Data: t.UnixNano()}
+	case time.Duration:
+		metric.Data = &rpc.Metric_Int64Data{Int64Data: int64(t)}
+	case Histogram, *Histogram:
+		return setJSONData(metric, t, histogramContentType)
+	case Summary, *Summary:
+		return setJSONData(metric, t, summaryContentType)
 	default:
-		return nil, fmt.Errorf("unsupported type: %s given in metric data", t)
+		// widen other numbers and named types by their kind
+		rv := reflect.ValueOf(data)
+		switch rv.Kind() {
+		case reflect.String:
+			metric.Data = &rpc.Metric_StringData{StringData: rv.String()}
+		case reflect.Bool:
+			metric.Data = &rpc.Metric_BoolData{BoolData: rv.Bool()}
+		case reflect.Float32:
+			metric.Data = &rpc.Metric_Float32Data{Float32Data: float32(rv.Float())}
+		case reflect.Float64:
+			metric.Data = &rpc.Metric_Float64Data{Float64Data: rv.Float()}
+		case reflect.Int8, reflect.Int16, reflect.Int32:
+			metric.Data = &rpc.Metric_Int32Data{Int32Data: int32(rv.Int())}
+		case reflect.Int, reflect.Int64:
+			metric.Data = &rpc.Metric_Int64Data{Int64Data: rv.Int()}
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+			metric.Data = &rpc.Metric_Uint32Data{Uint32Data: uint32(rv.Uint())}
+		case reflect.Uint, reflect.Uint64:
+			metric.Data = &rpc.Metric_Uint64Data{Uint64Data: rv.Uint()}
+		case reflect.Slice:
+			if rv.Type().Elem().Kind() == reflect.Uint8 {
+				metric.Data = &rpc.Metric_BytesData{BytesData: rv.Bytes()}
+				break
+			}
+			fallthrough
+		case reflect.Map, reflect.Array:
+			return setJSONData(metric, data, jsonContentType)
+		default:
+			return fmt.Errorf("unsupported type: %T given in metric data", data)
+		}
 	}
-	return metric, nil
+	return nil
+}
+
+// setJSONData sets the data of the protobuf metric to data encoded as JSON,
+// tagged with contentType.
+func setJSONData(metric *rpc.Metric, data interface{}, contentType string) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("cannot encode %T given in metric data: %v", data, err)
+	}
+	metric.Data = &rpc.Metric_BytesData{BytesData: b}
+	metric.Tags = withTag(metric.Tags, ContentTypeTag, contentType)
+	return nil
+}
+
+// withTag returns a copy of tags with the tag key set to value. Tags are
+// copied as they belong to the metric of the plugin.
+func withTag(tags map[string]string, key, value string) map[string]string {
+	copied := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		copied[k] = v
+	}
+	copied[key] = value
+	return copied
 }
 
+// withoutTags returns a copy of tags without the tags keys.
+func withoutTags(tags map[string]string, keys ...string) map[string]string {
+	copied := make(map[string]string, len(tags))
+	for k, v := range tags {
+		copied[k] = v
+	}
+	for _, k := range keys {
+		delete(copied, k)
+	}
+	return copied
+}
+
+// Converts a protobuf metric to a metric. Its data is set to the Go type of
+// the protobuf field, see Metric.Data.
 func fromProtoMetric(mt *rpc.Metric) Metric {
 	metric := Metric{
 		Namespace:   fromProtoNamespace(mt.Namespace),
@@ -114,9 +286,20 @@ func fromProtoMetric(mt *rpc.Metric) Metric {
 	}
 	metric.Config = fromProtoConfig(mt.Config)
 
+	// reserved tags set by toProtoMetric
+	var reserved []string
+	if kind, ok := mt.Tags[KindTag]; ok {
+		metric.Kind = MetricKind(kind)
+		reserved = append(reserved, KindTag)
+	}
+
 	switch mt.Data.(type) {
 	case *rpc.Metric_BytesData:
 		metric.Data = mt.GetBytesData()
+		if data, ok := decodeContent(mt.Tags[ContentTypeTag], mt.GetBytesData()); ok {
+			metric.Data = data
+			reserved = append(reserved, ContentTypeTag)
+		}
 	case *rpc.Metric_StringData:
 		metric.Data = mt.GetStringData()
 	case *rpc.Metric_Float64Data:
@@ -134,10 +317,70 @@ func fromProtoMetric(mt *rpc.Metric) Metric {
 	case *rpc.Metric_BoolData:
 		metric.Data = mt.GetBoolData()
 	}
+	if len(reserved) > 0 {
+		metric.Tags = withoutTags(mt.Tags, reserved...)
+	}
 
 	return metric
 }
 
+// decodeContent decodes metric data sent as bytes tagged with the
+// contentType set by the library. It returns false for other content types
+// and data which cannot be decoded, which are left as bytes.
+func decodeContent(contentType string, b []byte) (interface{}, bool) {
+	var (
+		data interface{}
+		err  error
+	)
+	switch contentType {
+	case jsonContentType:
+		data, err = decodeJSONData(b)
+	case histogramContentType:
+		var h Histogram
+		err = json.Unmarshal(b, &h)
+		data = h
+	case summaryContentType:
+		var s Summary
+		err = json.Unmarshal(b, &s)
+		data = s
+	default:
+		return nil, false
+	}
+	return data, err == nil
+}
+
+// decodeJSONData decodes structured metric data, keeping integral numbers
+// as int64.
+func decodeJSONData(b []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var data interface{}
+	if err := dec.Decode(&data); err != nil {
+		return nil, err
+	}
+	return fromJSONNumbers(data), nil
+}
+
+func fromJSONNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = fromJSONNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = fromJSONNumbers(e)
+		}
+	}
+	return v
+}
+
 func toProtoConfig(config Config) *rpc.ConfigMap {
 	if len(config) == 0 {
 		return nil
@@ -293,6 +536,24 @@ func (n Namespace) AddStaticElements(values ...string) Namespace {
 	return n
 }
 
+// Gauge returns a metric of the namespace of kind KindGauge, e.g. to be
+// listed by GetMetricTypes.
+func (n Namespace) Gauge() Metric {
+	return Metric{Namespace: n, Kind: KindGauge}
+}
+
+// Counter returns a metric of the namespace of kind KindCounter, e.g. to be
+// listed by GetMetricTypes.
+func (n Namespace) Counter() Metric {
+	return Metric{Namespace: n, Kind: KindCounter}
+}
+
+// Delta returns a metric of the namespace of kind KindDelta, e.g. to be
+// listed by GetMetricTypes.
+func (n Namespace) Delta() Metric {
+	return Metric{Namespace: n, Kind: KindDelta}
+}
+
 func (n Namespace) Element(idx int) NamespaceElement {
 	if idx >= 0 && idx < len(n) {
 		return n[idx]
@@ -300,6 +561,93 @@ func (n Namespace) Element(idx int) NamespaceElement {
 	return NamespaceElement{}
 }
 
+// Matches tells whether the namespace, used as a pattern, matches the
+// namespace other, e.g. a catalog entry the namespace of a collected
+// metric. An element "*" of the pattern matches any one element and an
+// element "**" matches any number of elements, including none. Other
+// elements match elements of the same value.
+func (n Namespace) Matches(other Namespace) bool {
+	_, ok := n.match(other)
+	return ok
+}
+
+// Bind returns a copy of the namespace with the values of its dynamic
+// elements set from values, keyed by element name. Elements without a value
+// are left as they are. The value of a dynamic "**" element is split on "/"
+// into elements of the same name, an empty value binding it to no element,
+// like Extract gives for a "**" element matching none.
+func (n Namespace) Bind(values map[string]string) Namespace {
+	bound := make(Namespace, 0, len(n))
+	for _, e := range n {
+		val, ok := values[e.Name]
+		switch {
+		case !e.IsDynamic() || !ok:
+			bound = append(bound, e)
+		case e.Value == "**" && val == "":
+		case e.Value == "**":
+			for _, v := range strings.Split(val, "/") {
+				bound = append(bound, NamespaceElement{Value: v, Name: e.Name, Description: e.Description})
+			}
+		default:
+			e.Value = val
+			bound = append(bound, e)
+		}
+	}
+	return bound
+}
+
+// Extract returns the values of the dynamic elements of the namespace,
+// keyed by element name, taken from the namespace concrete it matches, see
+// Matches. The values of the elements matched by a dynamic "**" element are
+// joined with "/". Extract returns nil if the namespace does not match.
+func (n Namespace) Extract(concrete Namespace) map[string]string {
+	starts, ok := n.match(concrete)
+	if !ok {
+		return nil
+	}
+	values := map[string]string{}
+	for i, e := range n {
+		if !e.IsDynamic() {
+			continue
+		}
+		end := len(concrete)
+		if i+1 < len(n) {
+			end = starts[i+1]
+		}
+		values[e.Name] = strings.Join(concrete[starts[i]:end].Strings(), "/")
+	}
+	return values
+}
+
+// match matches the namespace pattern against other, returning the index of
+// the first element of other matched by each element of the pattern.
+func (n Namespace) match(other Namespace) ([]int, bool) {
+	starts := make([]int, len(n))
+	var matchFrom func(pi, oi int) bool
+	matchFrom = func(pi, oi int) bool {
+		if pi == len(n) {
+			return oi == len(other)
+		}
+		starts[pi] = oi
+		switch n[pi].Value {
+		case "**":
+			for end := oi; end <= len(other); end++ {
+				if matchFrom(pi+1, end) {
+					return true
+				}
+			}
+			return false
+		case "*":
+		default:
+			if oi < len(other) && n[pi].Value != other[oi].Value {
+				return false
+			}
+		}
+		return oi < len(other) && matchFrom(pi+1, oi+1)
+	}
+	return starts, matchFrom(0, 0)
+}
+
 // String returns the string representation of the namespace with "/" joining
 // the elements of the namespace.  A leading "/" is added.
 func (n Namespace) String() string {
@@ -308,21 +656,102 @@ func (n Namespace) String() string {
 	return s + strings.Join(ns, s)
 }
 
+// Pattern returns the string representation of the namespace like String,
+// but with dynamic elements written as {name} instead of their value, so
+// that ParseNamespace gives back the metric type of the namespace. Static
+// elements written as {...} are escaped as {{...}}.
+func (n Namespace) Pattern() string {
+	elements := make([]string, len(n))
+	for i, e := range n {
+		switch {
+		case e.IsDynamic():
+			elements[i] = "{" + e.Name + "}"
+		case isBraced(e.Value):
+			elements[i] = "{" + e.Value + "}"
+		default:
+			elements[i] = e.Value
+		}
+	}
+	s := separatorOf(elements)
+	return s + strings.Join(elements, s)
+}
+
+// isBraced tells whether s is written as {...}.
+func isBraced(s string) bool {
+	return len(s) >= 2 && strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}")
+}
+
+// nsPriorityList holds the separators of namespace strings, the first not
+// found in any element is used.
+var nsPriorityList = []string{"/", "|", "%", ":", "-", ";", "_", "^", ">", "<", "+", "=", "&", "㊽", "Ä", "大", "小", "ᵹ", "☍", "ヒ"}
+
+// nsCoreSeparator is the separator used when all the separators of
+// nsPriorityList are found in elements.
+const nsCoreSeparator = "\U0001f422"
+
+// ParseNamespace parses the string representation of a namespace, as
+// returned by Namespace.Pattern or Namespace.String. The separator is taken
+// from the start of the string, which must be one of the separators they
+// use. An element written as {name} is parsed as a dynamic element of the
+// given name, like AddDynamicElement adds, and an element written as {{...}}
+// as the static element {...}. Metric types round-trip through Pattern and
+// ParseNamespace unchanged. String writes dynamic elements as their value,
+// so only static namespaces without elements written as {...} round-trip
+// through String.
+func ParseNamespace(s string) (Namespace, error) {
+	if s == "" {
+		return nil, fmt.Errorf("cannot parse an empty namespace")
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	sep := string(r)
+	if sep != nsCoreSeparator && !contains(nsPriorityList, sep) {
+		return nil, fmt.Errorf("namespace %q does not start with a separator", s)
+	}
+	if len(s) == size {
+		return Namespace{}, nil
+	}
+	elements := strings.Split(s[size:], sep)
+	ns := make(Namespace, len(elements))
+	for i, e := range elements {
+		switch {
+		case len(e) >= 4 && strings.HasPrefix(e, "{{") && strings.HasSuffix(e, "}}"):
+			ns[i] = NamespaceElement{Value: e[1 : len(e)-1]}
+		case len(e) > 2 && isBraced(e):
+			ns[i] = NamespaceElement{Value: "*", Name: e[1 : len(e)-1]}
+		default:
+			ns[i] = NamespaceElement{Value: e}
+		}
+	}
+	return ns, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
 // getSeparator returns the highest suitable separator from the nsPriorityList.
 // Otherwise the core separator is returned.
 func (n Namespace) getSeparator() string {
-	var nsPriorityList = []string{"/", "|", "%", ":", "-", ";", "_", "^", ">", "<", "+", "=", "&", "㊽", "Ä", "大", "小", "ᵹ", "☍", "ヒ"}
-	var Separator = "\U0001f422"
+	return separatorOf(n.Strings())
+}
 
+// separatorOf returns the highest separator from the nsPriorityList found in
+// none of the elements, or the core separator.
+func separatorOf(elements []string) string {
 	smap := map[string]bool{}
 
 	for _, s := range nsPriorityList {
 		smap[s] = false
 	}
 
-	for _, e := range n {
+	for _, e := range elements {
 		// look at each char
-		for _, r := range e.Value {
+		for _, r := range e {
 			ch := fmt.Sprintf("%c", r)
 			if v, ok := smap[ch]; ok && !v {
 				smap[ch] = true
@@ -336,7 +765,7 @@ func (n Namespace) getSeparator() string {
 			return s
 		}
 	}
-	return Separator
+	return nsCoreSeparator
 }
 
 // namespaceElement provides meta data related to the namespace.
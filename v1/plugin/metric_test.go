@@ -105,6 +105,142 @@ func TestToFromProtoMetric(t *testing.T) {
 	})
 }
 
+type kernelCounter uint16
+
+type label string
+
+type celsius struct {
+	value float64
+	err   error
+}
+
+func (c celsius) MetricValue() (interface{}, error) {
+	return c.value, c.err
+}
+
+type loopValuer struct{}
+
+func (loopValuer) MetricValue() (interface{}, error) {
+	return loopValuer{}, nil
+}
+
+func TestToProtoMetricData(t *testing.T) {
+	now := time.Now()
+	var nilValuer *celsius
+	tc := []struct {
+		data     interface{}
+		expected interface{}
+	}{
+		{int8(-8), int32(-8)},
+		{int16(-16), int32(-16)},
+		{uint(1), uint64(1)},
+		{uint8(8), uint32(8)},
+		{uint16(16), uint32(16)},
+		{kernelCounter(42), uint32(42)},
+		{label("up"), "up"},
+		{now, now.UnixNano()},
+		{time.Minute, int64(time.Minute)},
+		{celsius{value: 21.5}, 21.5},
+		{nilValuer, nil},
+	}
+	Convey("Test widening metric data", t, func() {
+		for _, c := range tc {
+			Convey(fmt.Sprintf("Test metric data %T", c.data), func() {
+				protoMetric, err := toProtoMetric(Metric{Namespace: NewNamespace("a"), Data: c.data})
+				So(err, ShouldBeNil)
+				So(fromProtoMetric(protoMetric).Data, ShouldEqual, c.expected)
+			})
+		}
+		Convey("Test unsupported metric data", func() {
+			for _, data := range []interface{}{
+				struct{}{},
+				make(chan int),
+				celsius{err: fmt.Errorf("sensor unavailable")},
+				loopValuer{},
+			} {
+				_, err := toProtoMetric(Metric{Namespace: NewNamespace("a"), Data: data})
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestStructuredMetricData(t *testing.T) {
+	Convey("Test structured metric data", t, func() {
+		tags := map[string]string{"label": "abc"}
+		Convey("maps should be sent as JSON and decoded back", func() {
+			data := map[string]interface{}{
+				"cpu":     []int64{1, 2},
+				"ratio":   0.5,
+				"counter": uint64(1 << 60),
+				"name":    "x",
+			}
+			protoMetric, err := toProtoMetric(Metric{Namespace: NewNamespace("a"), Data: data, Tags: tags})
+			So(err, ShouldBeNil)
+			So(protoMetric.GetBytesData(), ShouldNotBeEmpty)
+			So(protoMetric.Tags[ContentTypeTag], ShouldEqual, "application/json")
+			So(tags, ShouldResemble, map[string]string{"label": "abc"})
+
+			mt := fromProtoMetric(protoMetric)
+			So(mt.Tags, ShouldResemble, tags)
+			So(mt.Data, ShouldResemble, map[string]interface{}{
+				"cpu":     []interface{}{int64(1), int64(2)},
+				"ratio":   0.5,
+				"counter": int64(1 << 60),
+				"name":    "x",
+			})
+			So(protoMetric.Tags[ContentTypeTag], ShouldEqual, "application/json")
+		})
+		Convey("slices should be sent as JSON and decoded back", func() {
+			protoMetric, err := toProtoMetric(Metric{Namespace: NewNamespace("a"), Data: []float64{0.5, 1}})
+			So(err, ShouldBeNil)
+			mt := fromProtoMetric(protoMetric)
+			So(mt.Data, ShouldResemble, []interface{}{0.5, int64(1)})
+			So(mt.Tags, ShouldBeEmpty)
+		})
+		Convey("bytes with other content types should be left alone", func() {
+			tags := map[string]string{ContentTypeTag: "text/plain"}
+			protoMetric, err := toProtoMetric(Metric{Namespace: NewNamespace("a"), Data: []byte("{}"), Tags: tags})
+			So(err, ShouldBeNil)
+			mt := fromProtoMetric(protoMetric)
+			So(mt.Data, ShouldResemble, []byte("{}"))
+			So(mt.Tags, ShouldResemble, tags)
+		})
+		Convey("data which cannot be encoded should be rejected", func() {
+			_, err := toProtoMetric(Metric{Namespace: NewNamespace("a"), Data: map[string]interface{}{"f": func() {}}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestMetricKind(t *testing.T) {
+	Convey("Test metric kinds", t, func() {
+		ns := NewNamespace("a", "b")
+		So(ns.Gauge(), ShouldResemble, Metric{Namespace: ns, Kind: KindGauge})
+		So(ns.Counter().Kind, ShouldEqual, KindCounter)
+		So(ns.Delta().Kind, ShouldEqual, KindDelta)
+
+		Convey("kind should be sent as a reserved tag", func() {
+			tags := map[string]string{"label": "abc"}
+			protoMetric, err := toProtoMetric(Metric{Namespace: ns, Kind: KindCounter, Tags: tags, Data: map[string]int{"a": 1}})
+			So(err, ShouldBeNil)
+			So(protoMetric.Tags[KindTag], ShouldEqual, "counter")
+			So(tags, ShouldResemble, map[string]string{"label": "abc"})
+
+			mt := fromProtoMetric(protoMetric)
+			So(mt.Kind, ShouldEqual, KindCounter)
+			So(mt.Tags, ShouldResemble, tags)
+			So(mt.Data, ShouldResemble, map[string]interface{}{"a": int64(1)})
+		})
+		Convey("metrics without kind should not be tagged", func() {
+			protoMetric, err := toProtoMetric(Metric{Namespace: ns, Data: 1})
+			So(err, ShouldBeNil)
+			So(protoMetric.Tags, ShouldBeNil)
+			So(fromProtoMetric(protoMetric).Kind, ShouldEqual, KindUnknown)
+		})
+	})
+}
+
 func TestMetricConfig(t *testing.T) {
 	tc := metricConfigTestCases()
 
@@ -165,6 +301,107 @@ func TestMetricTime(t *testing.T) {
 	})
 }
 
+func TestNamespaceMatching(t *testing.T) {
+	Convey("Test namespace patterns", t, func() {
+		pattern := NewNamespace("intel", "disk").AddDynamicElement("device", "disk device").AddStaticElement("reads")
+		deep := NewNamespace("intel", "fs").AddDynamicElement("path", "mount point").AddStaticElement("free")
+		deep[2].Value = "**"
+
+		Convey("Matches", func() {
+			So(pattern.Matches(NewNamespace("intel", "disk", "sda", "reads")), ShouldBeTrue)
+			So(pattern.Matches(NewNamespace("intel", "disk", "sda", "writes")), ShouldBeFalse)
+			So(pattern.Matches(NewNamespace("intel", "disk", "sda")), ShouldBeFalse)
+			So(pattern.Matches(NewNamespace("intel", "disk", "sda", "reads", "x")), ShouldBeFalse)
+			So(deep.Matches(NewNamespace("intel", "fs", "free")), ShouldBeTrue)
+			So(deep.Matches(NewNamespace("intel", "fs", "var", "lib", "free")), ShouldBeTrue)
+			So(deep.Matches(NewNamespace("intel", "fs", "var", "lib")), ShouldBeFalse)
+			So(NewNamespace("**").Matches(Namespace{}), ShouldBeTrue)
+			So(Namespace{}.Matches(NewNamespace("a")), ShouldBeFalse)
+		})
+		Convey("Extract", func() {
+			So(pattern.Extract(NewNamespace("intel", "disk", "sda", "reads")), ShouldResemble, map[string]string{"device": "sda"})
+			So(deep.Extract(NewNamespace("intel", "fs", "var", "lib", "free")), ShouldResemble, map[string]string{"path": "var/lib"})
+			So(deep.Extract(NewNamespace("intel", "fs", "free")), ShouldResemble, map[string]string{"path": ""})
+			So(pattern.Extract(NewNamespace("intel", "disk")), ShouldBeNil)
+		})
+		Convey("Bind", func() {
+			bound := pattern.Bind(map[string]string{"device": "sdb"})
+			So(bound.Strings(), ShouldResemble, []string{"intel", "disk", "sdb", "reads"})
+			So(bound[2].Name, ShouldEqual, "device")
+			So(pattern[2].Value, ShouldEqual, "*")
+			So(pattern.Bind(nil), ShouldResemble, pattern)
+			So(deep.Bind(map[string]string{"path": "var/lib"}).Strings(), ShouldResemble, []string{"intel", "fs", "var", "lib", "free"})
+			So(pattern.Extract(bound), ShouldResemble, map[string]string{"device": "sdb"})
+
+			empty := NewNamespace("intel", "fs", "free")
+			So(deep.Bind(deep.Extract(empty)).Strings(), ShouldResemble, empty.Strings())
+			So(deep.Bind(map[string]string{"path": ""}), ShouldHaveLength, 3)
+		})
+	})
+}
+
+func TestParseNamespace(t *testing.T) {
+	Convey("Test parsing namespaces", t, func() {
+		Convey("namespaces should round-trip for every separator", func() {
+			separators := append(append([]string{}, nsPriorityList...), nsCoreSeparator)
+			for i, sep := range separators {
+				// elements holding all the separators of higher priority
+				ns := NewNamespace(append([]string{"x"}, nsPriorityList[:i]...)...)
+				s := ns.String()
+				So(s, ShouldStartWith, sep)
+				parsed, err := ParseNamespace(s)
+				So(err, ShouldBeNil)
+				So(parsed, ShouldResemble, ns)
+				So(parsed.String(), ShouldEqual, s)
+			}
+		})
+		Convey("dynamic elements should be parsed", func() {
+			ns, err := ParseNamespace("/intel/disk/{device}/reads")
+			So(err, ShouldBeNil)
+			So(ns, ShouldResemble, NewNamespace("intel", "disk").AddDynamicElement("device", "").AddStaticElement("reads"))
+			So(ns.String(), ShouldEqual, "/intel/disk/*/reads")
+		})
+		Convey("metric types should round-trip through Pattern", func() {
+			ns := NewNamespace("intel", "disk").AddDynamicElement("device", "disk device").AddStaticElement("reads")
+			So(ns.Pattern(), ShouldEqual, "/intel/disk/{device}/reads")
+			parsed, err := ParseNamespace(ns.Pattern())
+			So(err, ShouldBeNil)
+			So(parsed.Strings(), ShouldResemble, ns.Strings())
+			So(parsed[2].Name, ShouldEqual, "device")
+			So(parsed.Pattern(), ShouldEqual, ns.Pattern())
+
+			ns = NewNamespace("a").AddDynamicElement("b/c", "")
+			So(ns.Pattern(), ShouldEqual, "|a|{b/c}")
+			parsed, err = ParseNamespace(ns.Pattern())
+			So(err, ShouldBeNil)
+			So(parsed, ShouldResemble, ns)
+		})
+		Convey("static elements written as {...} should be escaped", func() {
+			ns := NewNamespace("a", "{x}", "{{y}}", "{}", "{")
+			So(ns.Pattern(), ShouldEqual, "/a/{{x}}/{{{y}}}/{{}}/{")
+			parsed, err := ParseNamespace(ns.Pattern())
+			So(err, ShouldBeNil)
+			So(parsed, ShouldResemble, ns)
+			dyn, _ := parsed.IsDynamic()
+			So(dyn, ShouldBeFalse)
+		})
+		Convey("empty namespaces and elements", func() {
+			ns, err := ParseNamespace("/")
+			So(err, ShouldBeNil)
+			So(ns, ShouldBeEmpty)
+			ns, err = ParseNamespace("|a||{}")
+			So(err, ShouldBeNil)
+			So(ns, ShouldResemble, NewNamespace("a", "", "{}"))
+		})
+		Convey("invalid namespaces", func() {
+			_, err := ParseNamespace("")
+			So(err, ShouldNotBeNil)
+			_, err = ParseNamespace("intel/disk")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
 func TestCopyNamespace(t *testing.T) {
 	Convey("Having support for namespace copying", t, func() {
 		Convey("taking simple namespace instance", func() {
@@ -0,0 +1,83 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import "fmt"
+
+// PartialError is returned by CollectMetrics, together with the metrics
+// which could be collected, when only some of the requested metrics failed:
+//
+//	var perr plugin.PartialError
+//	for _, mt := range mts {
+//		v, err := readSensor(mt.Namespace)
+//		if err != nil {
+//			perr.Add(mt.Namespace, err)
+//			continue
+//		}
+//		mt.Data = v
+//		metrics = append(metrics, mt)
+//	}
+//	return metrics, perr.ErrorOrNil()
+//
+// The metrics are then sent to Snap instead of failing the whole
+// collection, and the failures are logged as warnings with the namespace,
+// error and task id. As Snap drops the metrics of a reply holding an error,
+// the failures are only reported to Snap in the Error field of the reply if
+// no metric could be collected. Return another error to fail the call.
+type PartialError struct {
+	Errors []MetricError
+}
+
+// MetricError is the error of collecting the metrics of a namespace.
+type MetricError struct {
+	Namespace Namespace
+	Err       error
+}
+
+func (e MetricError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Namespace, e.Err)
+}
+
+// Add records the error err of collecting the metrics of the namespace ns.
+func (e *PartialError) Add(ns Namespace, err error) {
+	e.Errors = append(e.Errors, MetricError{Namespace: CopyNamespace(ns), Err: err})
+}
+
+// ErrorOrNil returns e if it holds errors, and nil otherwise.
+func (e *PartialError) ErrorOrNil() error {
+	if e == nil || len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *PartialError) Error() string {
+	errs := make([]error, len(e.Errors))
+	for i, me := range e.Errors {
+		errs[i] = me
+	}
+	return fmt.Sprintf("failed to collect %d metric(s): %s", len(e.Errors), joinErrors(errs))
+}
+
+// asPartialError returns the PartialError err is, if any.
+func asPartialError(err error) (*PartialError, bool) {
+	e, ok := err.(*PartialError)
+	return e, ok && e != nil
+}
@@ -33,6 +33,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/urfave/cli"
@@ -60,6 +61,7 @@ var (
 		flConfig,
 		flAddr,
 		flPort,
+		flSocket,
 		flPprof,
 		flTLS,
 		flCertPath,
@@ -70,6 +72,12 @@ var (
 		flLogLevel,
 		flMaxCollectDuration,
 		flMaxMetricsBuffer,
+		flMetrics,
+		flMetricsFile,
+		flDryRunSink,
+		flStreamDuration,
+		flStreamCount,
+		flOutput,
 	}
 )
 
@@ -79,6 +87,10 @@ type Plugin interface {
 }
 
 // Collector is a plugin which is the source of new data in the Snap pipeline.
+//
+// CollectMetrics can return a *PartialError together with the metrics it
+// could collect, so that the failure of some metrics does not drop the
+// others.
 type Collector interface {
 	Plugin
 
@@ -340,78 +352,50 @@ func buildGRPCServer(typeOfPlugin pluginType, name string, version int, arg *Arg
 // generates a response for the initial stdin / stdout handshake, and starts
 // the plugin's gRPC server.
 func StartCollector(plugin Collector, name string, version int, opts ...MetaOpt) int {
-	app = cli.NewApp()
-	app.Flags = Flags
-	app.Action = startPlugin
+	return startApp(plugin, name, version, "a Snap collector", "StartCollector", opts)
+}
 
-	appArgs.plugin = plugin
-	appArgs.name = name
-	appArgs.version = version
-	appArgs.opts = opts
-	app.Version = strconv.Itoa(version)
-	app.Usage = "a Snap collector"
-	err := app.Run(getOSArgs())
-	if err != nil {
-		log.WithFields(log.Fields{
-			"_block": "StartCollector",
-		}).Error(err)
-		return 1
-	}
-	return 0
+// StartContextCollector is StartCollector for a ContextCollector.
+func StartContextCollector(plugin ContextCollector, name string, version int, opts ...MetaOpt) int {
+	return startApp(plugin, name, version, "a Snap collector", "StartContextCollector", opts)
 }
 
 // StartProcessor is given a Processor implementation and its metadata,
 // generates a response for the initial stdin / stdout handshake, and starts
 // the plugin's gRPC server.
 func StartProcessor(plugin Processor, name string, version int, opts ...MetaOpt) int {
-	app = cli.NewApp()
-	app.Flags = Flags
-	app.Action = startPlugin
+	return startApp(plugin, name, version, "a Snap processor", "StartProcessor", opts)
+}
 
-	appArgs.plugin = plugin
-	appArgs.name = name
-	appArgs.version = version
-	appArgs.opts = opts
-	app.Version = strconv.Itoa(version)
-	app.Usage = "a Snap processor"
-	err := app.Run(getOSArgs())
-	if err != nil {
-		log.WithFields(log.Fields{
-			"_block": "StartProcessor",
-		}).Error(err)
-		return 1
-	}
-	return 0
+// StartContextProcessor is StartProcessor for a ContextProcessor.
+func StartContextProcessor(plugin ContextProcessor, name string, version int, opts ...MetaOpt) int {
+	return startApp(plugin, name, version, "a Snap processor", "StartContextProcessor", opts)
 }
 
 // StartPublisher is given a Publisher implementation and its metadata,
 // generates a response for the initial stdin / stdout handshake, and starts
 // the plugin's gRPC server.
 func StartPublisher(plugin Publisher, name string, version int, opts ...MetaOpt) int {
-	app = cli.NewApp()
-	app.Flags = Flags
-	app.Action = startPlugin
+	return startApp(plugin, name, version, "a Snap publisher", "StartPublisher", opts)
+}
 
-	appArgs.plugin = plugin
-	appArgs.name = name
-	appArgs.version = version
-	appArgs.opts = opts
-	app.Version = strconv.Itoa(version)
-	app.Usage = "a Snap publisher"
-	err := app.Run(getOSArgs())
-	if err != nil {
-		log.WithFields(log.Fields{
-			"_block": "StartPublisher",
-		}).Error(err)
-		return 1
-	}
-	return 0
+// StartContextPublisher is StartPublisher for a ContextPublisher.
+func StartContextPublisher(plugin ContextPublisher, name string, version int, opts ...MetaOpt) int {
+	return startApp(plugin, name, version, "a Snap publisher", "StartContextPublisher", opts)
 }
 
 // StartStreamCollector is given a StreamCollector implementation and its metadata,
 // generates a response for the initial stdin / stdout handshake, and starts
 // the plugin's gRPC server.
 func StartStreamCollector(plugin StreamCollector, name string, version int, opts ...MetaOpt) int {
+	//set gRPCStream as RPC type
+	opts = append(opts, rpcType(gRPCStream))
+	return startApp(plugin, name, version, "a Snap collector", "StartStreamCollector", opts)
+}
+
+// startApp runs the CLI app starting the plugin, logging errors in the
+// given block, and returns the exit code of the plugin.
+func startApp(plugin Plugin, name string, version int, usage, block string, opts []MetaOpt) int {
 	app = cli.NewApp()
 	app.Flags = Flags
 	app.Action = startPlugin
@@ -419,15 +403,13 @@ func StartStreamCollector(plugin StreamCollector, name string, version int, opts
 	appArgs.plugin = plugin
 	appArgs.name = name
 	appArgs.version = version
-	//set gRPCStream as RPC type
-	opts = append(opts, rpcType(gRPCStream))
 	appArgs.opts = opts
 	app.Version = strconv.Itoa(version)
-	app.Usage = "a Snap collector"
+	app.Usage = usage
 	err := app.Run(getOSArgs())
 	if err != nil {
 		log.WithFields(log.Fields{
-			"_block": "StartStreamCollector",
+			"_block": block,
 		}).Error(err)
 		return 1
 	}
@@ -448,12 +430,6 @@ type preamble struct {
 }
 
 func startPlugin(c *cli.Context) error {
-	var (
-		server           *grpc.Server
-		meta             *meta
-		pluginProxy      *pluginProxy
-		MaxMetricsBuffer int64
-	)
 	libInputOutput.setContext(c)
 	arg, err := processInput(c)
 	if err != nil {
@@ -468,83 +444,14 @@ func startPlugin(c *cli.Context) error {
 		log.Fields{
 			"_block": "startPlugin",
 		})
-	switch plugin := appArgs.plugin.(type) {
-	case Collector:
-		proxy := &collectorProxy{
-			plugin:      plugin,
-			pluginProxy: *newPluginProxy(plugin),
-		}
-		pluginProxy = &proxy.pluginProxy
-		server, meta, err = buildGRPCServer(collectorType, appArgs.name, appArgs.version, arg, appArgs.opts...)
-		if err != nil {
-			return cli.NewExitError(err, 2)
-		}
-		rpc.RegisterCollectorServer(server, proxy)
-	case Processor:
-		proxy := &processorProxy{
-			plugin:      plugin,
-			pluginProxy: *newPluginProxy(plugin),
-		}
-		pluginProxy = &proxy.pluginProxy
-		server, meta, err = buildGRPCServer(processorType, appArgs.name, appArgs.version, arg, appArgs.opts...)
-		if err != nil {
-			return cli.NewExitError(err, 2)
-		}
-		rpc.RegisterProcessorServer(server, proxy)
-	case Publisher:
-		proxy := &publisherProxy{
-			plugin:      plugin,
-			pluginProxy: *newPluginProxy(plugin),
-		}
-		pluginProxy = &proxy.pluginProxy
-		server, meta, err = buildGRPCServer(publisherType, appArgs.name, appArgs.version, arg, appArgs.opts...)
-		if err != nil {
-			return cli.NewExitError(err, 2)
-		}
-		rpc.RegisterPublisherServer(server, proxy)
-	case StreamCollector:
-		if c.IsSet("max-metrics-buffer") {
-			MaxMetricsBuffer = c.Int64("max-metrics-buffer")
-		} else {
-			MaxMetricsBuffer = defaultMaxMetricsBuffer
-		}
-
-		logger.WithFields(log.Fields{
-			"option": "max-metrics-buffer",
-			"value":  MaxMetricsBuffer,
-		}).Debug("setting max metrics buffer")
-
-		maxCollectDuration, err := time.ParseDuration(collectDurationStr)
-		if err != nil {
-			return err
-		}
-
-		logger.WithFields(log.Fields{
-			"option": "max-collect-duration",
-			"value":  maxCollectDuration,
-		}).Debug("setting max collect duration")
-
-		proxy := &StreamProxy{
-			plugin:             plugin,
-			ctx:                context.Background(),
-			pluginProxy:        *newPluginProxy(plugin),
-			maxCollectDuration: maxCollectDuration,
-			maxMetricsBuffer:   MaxMetricsBuffer,
-		}
-
-		pluginProxy = &proxy.pluginProxy
-		server, meta, err = buildGRPCServer(streamCollectorType, appArgs.name, appArgs.version, arg, appArgs.opts...)
-		if err != nil {
-			return cli.NewExitError(err, 2)
-		}
-		rpc.RegisterStreamCollectorServer(server, proxy)
-	default:
-		logger.WithField("type", fmt.Sprintf("%T", plugin)).Fatal("Unknown plugin type")
+	server, meta, pluginProxy, err := buildPluginServer(appArgs.plugin, appArgs.name, appArgs.version, arg, appArgs.opts...)
+	if err != nil {
+		return cli.NewExitError(err, 2)
 	}
 
 	if c.Bool("stand-alone") {
 		httpPort := c.Int("stand-alone-port")
-		preamble, err := printPreambleAndServe(server, meta, pluginProxy, arg.ListenPort, arg.Pprof)
+		preamble, err := printPreambleAndServe(server, meta, pluginProxy, arg)
 		if err != nil {
 			return err
 		}
@@ -569,18 +476,20 @@ func startPlugin(c *cli.Context) error {
 				log.Fatal(err)
 			}
 		}()
-		<-pluginProxy.halt
+		go pluginProxy.tasks.watch(pluginProxy.plugin)
+		pluginProxy.waitForShutdown(server)
 
 	} else if libInputOutput.args() > 0 {
 		// snapteld is starting the plugin
 		// presumably with a single arg (valid json)
-		preamble, err := printPreambleAndServe(server, meta, pluginProxy, arg.ListenPort, arg.Pprof)
+		preamble, err := printPreambleAndServe(server, meta, pluginProxy, arg)
 		if err != nil {
 			log.Fatal(err)
 		}
 		libInputOutput.printOut(preamble)
 		go pluginProxy.HeartbeatWatch()
-		<-pluginProxy.halt
+		go pluginProxy.tasks.watch(pluginProxy.plugin)
+		pluginProxy.waitForShutdown(server)
 
 	} else {
 		// no arguments provided - run and display diagnostics to the user
@@ -602,32 +511,191 @@ func startPlugin(c *cli.Context) error {
 			}).Errorf("cannot get config policy")
 			return err
 		}
+		// JSON numbers are all float64, convert them to the types of the rules
+		config.applyNumberRules(cPolicy)
 		// Update config with defaults from config policy
 		config.applyDefaults(cPolicy)
 
+		output := c.String("output")
+		switch output {
+		case outputText:
+		case outputJSON, outputYAML:
+			if _, ok := pluginProxy.plugin.(Collector); !ok {
+				return fmt.Errorf("! Diagnostics output %q is only available for collector plugins", output)
+			}
+		default:
+			return fmt.Errorf("! Unknown diagnostics output %q, please use one of: text, json, yaml", output)
+		}
+
 		switch pluginProxy.plugin.(type) {
 		case Collector:
+			if output != outputText {
+				return showStructuredDiagnostics(*meta, pluginProxy, config, output)
+			}
 			return showDiagnostics(*meta, pluginProxy, config)
 		case StreamCollector:
-			fmt.Println("Diagnostics not currently available for streaming collector plugins.")
+			maxMetricsBuffer, maxCollectDuration, err := streamOptions()
+			if err != nil {
+				return err
+			}
+			return showStreamDiagnostics(*meta, pluginProxy, config, maxMetricsBuffer, maxCollectDuration, c.Duration("stream-duration"), c.Int("stream-count"))
 		case Processor:
-			fmt.Println("Diagnostics not currently available for processor plugins.")
+			mts, err := readSampleMetrics(c)
+			if err != nil {
+				return err
+			}
+			return showProcessorDiagnostics(*meta, pluginProxy, config, mts)
 		case Publisher:
-			fmt.Println("Diagnostics not currently available for publisher plugins.")
+			mts, err := readSampleMetrics(c)
+			if err != nil {
+				return err
+			}
+			return showPublisherDiagnostics(*meta, pluginProxy, config, mts, c.String("dry-run-sink"))
 		}
 	}
 	return nil
 }
 
-func printPreambleAndServe(srv server, m *meta, p *pluginProxy, port string, isPprof bool) (string, error) {
-	l, err := net.Listen("tcp", fmt.Sprintf("%s:%v", ListenAddr, port))
+// buildPluginServer wraps the given plugin in the proxy matching its type and
+// registers it with a gRPC server built by buildGRPCServer.
+func buildPluginServer(plugin Plugin, name string, version int, arg *Arg, opts ...MetaOpt) (server *grpc.Server, m *meta, pluginProxy *pluginProxy, err error) {
+	switch plugin := withoutContext(plugin).(type) {
+	case Collector:
+		proxy := &collectorProxy{
+			plugin:      plugin,
+			pluginProxy: *newPluginProxy(plugin),
+		}
+		pluginProxy = &proxy.pluginProxy
+		server, m, err = buildGRPCServer(collectorType, name, version, arg, opts...)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		rpc.RegisterCollectorServer(server, proxy)
+	case Processor:
+		proxy := &processorProxy{
+			plugin:      plugin,
+			pluginProxy: *newPluginProxy(plugin),
+		}
+		pluginProxy = &proxy.pluginProxy
+		server, m, err = buildGRPCServer(processorType, name, version, arg, opts...)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		rpc.RegisterProcessorServer(server, proxy)
+	case Publisher:
+		proxy := &publisherProxy{
+			plugin:      plugin,
+			pluginProxy: *newPluginProxy(plugin),
+		}
+		pluginProxy = &proxy.pluginProxy
+		server, m, err = buildGRPCServer(publisherType, name, version, arg, opts...)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		rpc.RegisterPublisherServer(server, proxy)
+	case StreamCollector:
+		maxMetricsBuffer, maxCollectDuration, err := streamOptions()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		proxy := &StreamProxy{
+			plugin:             plugin,
+			ctx:                context.Background(),
+			pluginProxy:        *newPluginProxy(plugin),
+			maxCollectDuration: maxCollectDuration,
+			maxMetricsBuffer:   maxMetricsBuffer,
+		}
+
+		pluginProxy = &proxy.pluginProxy
+		server, m, err = buildGRPCServer(streamCollectorType, name, version, arg, opts...)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		rpc.RegisterStreamCollectorServer(server, proxy)
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown plugin type: %T", plugin)
+	}
+	pluginProxy.validateConfig = m.validateConfig
+	pluginProxy.validateCatalog = m.validateCatalog
+	pluginProxy.tasks.idleTimeout = m.taskIdleTimeout
+	return server, m, pluginProxy, nil
+}
+
+// streamOptions returns the buffering options of a streaming collector,
+// which are set by the max-metrics-buffer and max-collect-duration flags.
+func streamOptions() (maxMetricsBuffer int64, maxCollectDuration time.Duration, err error) {
+	logger := log.WithFields(log.Fields{
+		"_block": "streamOptions",
+	})
+	maxMetricsBuffer = maxMetricsBufferNum
+
+	logger.WithFields(log.Fields{
+		"option": "max-metrics-buffer",
+		"value":  maxMetricsBuffer,
+	}).Debug("setting max metrics buffer")
+
+	maxCollectDuration, err = time.ParseDuration(collectDurationStr)
 	if err != nil {
-		return "", err
+		return 0, 0, err
 	}
-	l.Close()
 
-	addr := fmt.Sprintf("%s:%v", ListenAddr, l.Addr().(*net.TCPAddr).Port)
-	lis, err := net.Listen("tcp", addr)
+	logger.WithFields(log.Fields{
+		"option": "max-collect-duration",
+		"value":  maxCollectDuration,
+	}).Debug("setting max collect duration")
+	return maxMetricsBuffer, maxCollectDuration, nil
+}
+
+// ServePlugin builds the gRPC server for the given plugin exactly as the
+// Start* functions do, but serves it on the provided listener instead of
+// binding a TCP port. It returns the preamble that would be handed to
+// snapteld and a function stopping the server. The server is also stopped
+// gracefully, and the plugin shut down, when the plugin receives a Kill
+// call, see Shutdowner. ServePlugin is meant for testing
+// plugins in-process, see the plugintest package.
+func ServePlugin(lis net.Listener, plugin Plugin, name string, version int, opts ...MetaOpt) (string, func(), error) {
+	switch plugin.(type) {
+	case Collector, Processor, Publisher:
+	case StreamCollector:
+		opts = append(opts, rpcType(gRPCStream))
+	}
+	srv, m, p, err := buildPluginServer(plugin, name, version, &Arg{}, opts...)
+	if err != nil {
+		return "", nil, err
+	}
+	preamble, err := makePreamble(m, lis.Addr().String(), "0")
+	if err != nil {
+		return "", nil, err
+	}
+	go srv.Serve(lis)
+	go p.tasks.watch(p.plugin)
+
+	done := make(chan struct{})
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			close(done)
+			srv.Stop()
+			p.tasks.close()
+		})
+	}
+	go func() {
+		select {
+		case <-p.halt:
+			// let the Kill call return before closing the connections
+			once.Do(func() {
+				close(done)
+				p.shutdown(srv, p.haltReason)
+			})
+		case <-done:
+		}
+	}()
+	return preamble, stop, nil
+}
+
+func printPreambleAndServe(srv server, m *meta, p *pluginProxy, arg *Arg) (string, error) {
+	lis, listenAddr, err := listen(arg)
 	if err != nil {
 		return "", err
 	}
@@ -638,19 +706,88 @@ func printPreambleAndServe(srv server, m *meta, p *pluginProxy, port string, isP
 		}
 	}()
 	pprofAddr := "0"
-	if isPprof {
+	if arg.Pprof {
 		pprofAddr, err = startPprof()
 		if err != nil {
 			return "", err
 		}
 	}
+	return makePreamble(m, listenAddr, pprofAddr)
+}
+
+// listen returns the listener the plugin is served on and the address
+// advertised to snapteld for it. The plugin listens on the unix domain
+// socket arg.ListenSocket if given, which only the user running the plugin
+// can connect to, and otherwise on the TCP port arg.ListenPort of
+// ListenAddr, or on a free port if it is not given.
+func listen(arg *Arg) (net.Listener, string, error) {
+	if arg.ListenSocket != "" {
+		path, err := filepath.Abs(arg.ListenSocket)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := removeStaleSocket(path); err != nil {
+			return nil, "", err
+		}
+		lis, err := listenUnix(path)
+		if err != nil {
+			return nil, "", err
+		}
+		return lis, "unix://" + path, nil
+	}
+
+	lis, err := net.Listen("tcp", fmt.Sprintf("%s:%v", ListenAddr, arg.ListenPort))
+	if err != nil {
+		return nil, "", err
+	}
 	advertisedAddr, err := getAddr(ListenAddr)
 	if err != nil {
-		return "", err
+		lis.Close()
+		return nil, "", err
 	}
+	return lis, fmt.Sprintf("%v:%v", advertisedAddr, lis.Addr().(*net.TCPAddr).Port), nil
+}
+
+// removeStaleSocket removes the socket left at path by a plugin which did
+// not exit cleanly. A socket still accepting connections is left alone.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("cannot listen on %s: file exists and is not a socket", path)
+	}
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("cannot listen on %s: socket is in use", path)
+	}
+	if !isConnRefused(err) {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// isConnRefused tells whether err is a refused connection.
+func isConnRefused(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	if sysErr, ok := err.(*os.SyscallError); ok {
+		err = sysErr.Err
+	}
+	return isConnRefusedErrno(err)
+}
+
+// makePreamble returns the JSON preamble advertising the plugin listening on
+// the given address.
+func makePreamble(m *meta, listenAddr, pprofAddr string) (string, error) {
 	resp := preamble{
 		Meta:          *m,
-		ListenAddress: fmt.Sprintf("%v:%v", advertisedAddr, l.Addr().(*net.TCPAddr).Port),
+		ListenAddress: listenAddr,
 		Type:          m.Type,
 		PprofAddress:  pprofAddr,
 		State:         0, // Hardcode success since panics on err
@@ -720,13 +857,14 @@ func printMetricTypes(p *pluginProxy, conf Config) ([]Metric, error) {
 	for _, j := range met {
 		fmt.Printf("    Namespace: %v \n", j.Namespace.String())
 	}
+	printCatalogWarnings(met)
 	return met, nil
 }
 
 func printConfigPolicy(p *pluginProxy, conf Config) error {
 	defer timeTrack(time.Now(), "printConfigPolicy")
 	requiredConfigs := ""
-	cPolicy, err := p.plugin.(Collector).GetConfigPolicy()
+	cPolicy, err := p.plugin.GetConfigPolicy()
 	if err != nil {
 		return err
 	}
@@ -741,6 +879,7 @@ func printConfigPolicy(p *pluginProxy, conf Config) error {
 	requiredConfigs += printConfigPolicyBoolRules(cPolicy, conf, w)
 
 	w.Flush()
+	printStringConstraints(cPolicy)
 	if requiredConfigs != "" {
 		requiredConfigs += "! Please provide config in form of: -config '{\"key\":\"kelly\", \"spirit-animal\":\"coatimundi\"}'\n"
 		err := fmt.Errorf(requiredConfigs)
@@ -750,6 +889,27 @@ func printConfigPolicy(p *pluginProxy, conf Config) error {
 	return nil
 }
 
+// printStringConstraints lists the constraints of string rules, which do not
+// fit the config policy table.
+func printStringConstraints(cPolicy ConfigPolicy) {
+	var rows [][]interface{}
+	for ns, keys := range cPolicy.stringConstraints {
+		for key, sc := range keys {
+			rows = append(rows, []interface{}{ns, key, sc.String()})
+		}
+	}
+	if len(rows) == 0 {
+		return
+	}
+	fmt.Println("String constraints:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	printFields(w, false, 0, "NAMESPACE", "KEY", "CONSTRAINTS")
+	for _, row := range rows {
+		printFields(w, false, 0, row...)
+	}
+	w.Flush()
+}
+
 func printFields(tw *tabwriter.Writer, indent bool, width int, fields ...interface{}) {
 	var argArray []interface{}
 	if indent {
@@ -927,13 +1087,20 @@ func printConfigPolicyBoolRules(cPolicy ConfigPolicy, conf Config, w *tabwriter.
 func printCollectMetrics(p *pluginProxy, m []Metric) error {
 	defer timeTrack(time.Now(), "printCollectMetrics")
 	cltd, err := p.plugin.(Collector).CollectMetrics(m)
-	if err != nil {
+	perr, partial := asPartialError(err)
+	if err != nil && !partial {
 		return fmt.Errorf("! Error in the call to CollectMetrics. Please ensure your config contains any required fields mentioned in the error below. \n %v", err)
 	}
 	fmt.Println("Metrics that can be collected right now are: ")
 	for _, j := range cltd {
 		fmt.Printf("    Namespace: %-30v  Type: %-10T  Value: %v \n", j.Namespace, j.Data, j.Data)
 	}
+	if partial {
+		fmt.Println("! Warning: metrics that failed to be collected are: ")
+		for _, me := range perr.Errors {
+			fmt.Printf("    Namespace: %-30v  Error: %v \n", me.Namespace, me.Err)
+		}
+	}
 	return nil
 }
 
@@ -960,6 +1127,9 @@ func processInput(c *cli.Context) (*Arg, error) {
 	if c.IsSet("port") {
 		arg.ListenPort = c.String("port")
 	}
+	if c.IsSet("socket") {
+		arg.ListenSocket = c.String("socket")
+	}
 	if c.IsSet("pprof") {
 		arg.Pprof = c.Bool("pprof")
 	}
@@ -21,11 +21,15 @@ package plugin
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin/rpc"
+	log "github.com/sirupsen/logrus"
 )
 
 // TODO(danielscottt): logging
@@ -49,6 +53,23 @@ type pluginProxy struct {
 	LastPing            time.Time
 	PingTimeoutDuration time.Duration
 	halt                chan struct{}
+	// haltReason is the reason the plugin is halted for, set before halt
+	// is closed.
+	haltReason string
+	haltOnce   sync.Once
+
+	// validateConfig makes the proxy reject config breaking the plugin's
+	// config policy, see ValidateConfig.
+	validateConfig bool
+	// validateCatalog makes the proxy reject metric catalogs with problems,
+	// see ValidateCatalog.
+	validateCatalog bool
+	// tasks calls the TaskStarter and TaskStopper hooks of the plugin.
+	tasks *taskTracker
+	// policy is the config policy of the plugin, got once when the proxy
+	// is created to check the config of requests, or the error getting it.
+	policy    ConfigPolicy
+	policyErr error
 }
 
 // pluginProxyCtor refers to function creating a new plugin proxy instance,
@@ -63,10 +84,14 @@ func newPluginProxy(plugin Plugin) *pluginProxy {
 // defaultPluginProxyCtor delivers new plugin instance using default setup
 // (e.g.: default plugin timeout)
 func defaultPluginProxyCtor(plugin Plugin) *pluginProxy {
+	policy, err := plugin.GetConfigPolicy()
 	return &pluginProxy{
 		plugin:              plugin,
 		PingTimeoutDuration: PingTimeoutDuration,
 		halt:                make(chan struct{}),
+		tasks:               newTaskTracker(),
+		policy:              policy,
+		policyErr:           err,
 	}
 }
 
@@ -78,11 +103,23 @@ func (p *pluginProxy) Ping(ctx context.Context, arg *rpc.Empty) (*rpc.ErrReply,
 }
 
 func (p *pluginProxy) Kill(ctx context.Context, arg *rpc.KillArg) (*rpc.ErrReply, error) {
-	// TODO(CDR) log kill reason
-	p.halt <- struct{}{}
+	log.WithFields(log.Fields{
+		"_block": "Kill",
+		"reason": arg.Reason,
+	}).Info("Kill received")
+	p.stop("killed: " + arg.Reason)
 	return &rpc.ErrReply{}, nil
 }
 
+// stop halts the plugin for reason. Only the first reason is kept, later
+// calls do nothing.
+func (p *pluginProxy) stop(reason string) {
+	p.haltOnce.Do(func() {
+		p.haltReason = reason
+		close(p.halt)
+	})
+}
+
 func (p *pluginProxy) GetConfigPolicy(ctx context.Context, arg *rpc.Empty) (*rpc.GetConfigPolicyReply, error) {
 	policy, err := p.plugin.GetConfigPolicy()
 	if err != nil {
@@ -91,6 +128,81 @@ func (p *pluginProxy) GetConfigPolicy(ctx context.Context, arg *rpc.Empty) (*rpc
 	return newGetConfigPolicyReply(policy), nil
 }
 
+// checkConfig validates cfg against the plugin's config policy. The
+// constraints of string rules, which snapteld does not know about, are
+// always checked; the other rules only if config validation is enabled.
+// Failing to get the config policy fails the check.
+func (p *pluginProxy) checkConfig(cfg Config) error {
+	if p.policyErr != nil {
+		return p.policyErr
+	}
+	if p.validateConfig {
+		return configStatusError(p.policy.Validate(cfg))
+	}
+	return configStatusError(p.policy.validateStringConstraints(cfg, func([]string) bool { return true }))
+}
+
+// checkMetricsConfig validates the config of each metric against the
+// policies of the plugin's config policy applying to its namespace, like
+// checkConfig.
+func (p *pluginProxy) checkMetricsConfig(mts []Metric) error {
+	if p.policyErr != nil {
+		return p.policyErr
+	}
+	policy := &p.policy
+	var errs []error
+	seen := map[string]bool{}
+	for _, mt := range mts {
+		var mtErrs []error
+		if p.validateConfig {
+			mtErrs = policy.validateNamespace(mt.Config, mt.Namespace)
+		} else {
+			ns := mt.Namespace
+			mtErrs = policy.validateStringConstraints(mt.Config, func(key []string) bool {
+				return isNamespacePrefix(key, ns)
+			})
+		}
+		for _, e := range mtErrs {
+			if !seen[e.Error()] {
+				seen[e.Error()] = true
+				errs = append(errs, e)
+			}
+		}
+	}
+	return configStatusError(errs)
+}
+
+// configStatusError returns an InvalidArgument gRPC error listing errs, or
+// nil if there are none.
+func configStatusError(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return status.Errorf(codes.InvalidArgument, "config rejected by config policy: %s", joinErrors(errs))
+}
+
+// checkCatalog validates the metric types returned by GetMetricTypes if
+// catalog validation is enabled, see ValidateCatalog.
+func (p *pluginProxy) checkCatalog(mts []Metric) error {
+	if !p.validateCatalog {
+		return nil
+	}
+	if errs := validateCatalog(mts); len(errs) > 0 {
+		return status.Errorf(codes.InvalidArgument, "invalid metric catalog: %s", joinErrors(errs))
+	}
+	return nil
+}
+
+// trackTask records a call for the task of ctx, calling the TaskStarter
+// hook of the plugin with cfg if the task is new.
+func (p *pluginProxy) trackTask(ctx context.Context, cfg Config) error {
+	task, ok := TaskFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return p.tasks.seen(p.plugin, task, cfg)
+}
+
 func (p *pluginProxy) HeartbeatWatch() {
 	p.LastPing = time.Now()
 	fmt.Println("Heartbeat started")
@@ -101,7 +213,7 @@ func (p *pluginProxy) HeartbeatWatch() {
 			fmt.Printf("Heartbeat timeout %v of %v.  (Duration between checks %v)", count, PingTimeoutLimit, p.PingTimeoutDuration)
 			if count >= PingTimeoutLimit {
 				fmt.Println("Heartbeat timeout expired!")
-				defer close(p.halt)
+				p.stop("heartbeat timeout expired")
 				return
 			}
 		} else {
@@ -26,7 +26,10 @@ import (
 	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"net"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -133,6 +136,12 @@ func TestParsingArgs(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(args.PingTimeoutDuration, ShouldEqual, 3141)
 		})
+		Convey("ListenSocket should be properly parsed", func() {
+			mockInputOutput.mockArg = `{"ListenSocket":"/run/snap/plugin.sock"}`
+			args, err := processArg(&Arg{})
+			So(err, ShouldBeNil)
+			So(args.ListenSocket, ShouldEqual, "/run/snap/plugin.sock")
+		})
 		Convey("RootCertPaths should be properly parsed", func() {
 			mockInputOutput.mockArg = `{"RootCertPaths":"test-cert.crt"}`
 			args, err := processArg(&Arg{})
@@ -145,6 +154,64 @@ func TestParsingArgs(t *testing.T) {
 	})
 }
 
+func TestListen(t *testing.T) {
+	Convey("With plugin lib listening for snapteld", t, func() {
+		Convey("TCP port should be advertised", func() {
+			lis, addr, err := listen(&Arg{})
+			So(err, ShouldBeNil)
+			defer lis.Close()
+			So(addr, ShouldEqual, lis.Addr().String())
+		})
+		Convey("with a unix domain socket", func() {
+			dir, err := ioutil.TempDir("", "snap-plugin-lib-go")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "plugin.sock")
+
+			Convey("socket should only be accessible to the user and advertised", func() {
+				lis, addr, err := listen(&Arg{ListenSocket: path})
+				So(err, ShouldBeNil)
+				defer lis.Close()
+				So(addr, ShouldEqual, "unix://"+path)
+				fi, err := os.Stat(path)
+				So(err, ShouldBeNil)
+				So(fi.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+				conn, err := net.Dial("unix", path)
+				So(err, ShouldBeNil)
+				conn.Close()
+			})
+			Convey("stale socket should be replaced", func() {
+				// unlike listeners, packet sockets leave their file on close
+				stale, err := net.ListenPacket("unixgram", path)
+				So(err, ShouldBeNil)
+				stale.Close()
+				_, err = os.Stat(path)
+				So(err, ShouldBeNil)
+				lis, _, err := listen(&Arg{ListenSocket: path})
+				So(err, ShouldBeNil)
+				lis.Close()
+			})
+			Convey("socket in use should not be replaced", func() {
+				lis, _, err := listen(&Arg{ListenSocket: path})
+				So(err, ShouldBeNil)
+				defer lis.Close()
+				_, _, err = listen(&Arg{ListenSocket: path})
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "in use")
+				conn, err := net.Dial("unix", path)
+				So(err, ShouldBeNil)
+				conn.Close()
+			})
+			Convey("other files should not be replaced", func() {
+				So(ioutil.WriteFile(path, []byte("data"), 0600), ShouldBeNil)
+				_, _, err := listen(&Arg{ListenSocket: path})
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "not a socket")
+			})
+		})
+	})
+}
+
 func TestPassingPluginMeta(t *testing.T) {
 	Convey("With plugin lib transferring plugin meta", t, func() {
 		log.SetLevel(log.DebugLevel)
@@ -0,0 +1,183 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package plugintest runs Snap plugins in-process behind the same gRPC
+// servers snapteld talks to, so that plugin tests exercise the metric and
+// config policy conversions and the preamble instead of calling plugin
+// methods directly.
+//
+// A collector can be tested like this:
+//
+//	c, err := plugintest.NewCollector(myCollector{}, "my-collector", 1)
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer c.Close()
+//	reply, err := c.CollectMetrics(context.Background(), &rpc.MetricsArg{
+//		Metrics: []*rpc.Metric{plugintest.NewMetric([]string{"my", "metric"}, nil)},
+//	})
+package plugintest
+
+import (
+	"encoding/json"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin/rpc"
+)
+
+// Meta is the plugin metadata advertised in the preamble.
+type Meta struct {
+	Type             int
+	Name             string
+	Version          int
+	RPCType          int
+	RPCVersion       int
+	ConcurrencyCount int
+	Exclusive        bool
+	Unsecure         bool
+	CacheTTL         time.Duration
+	RoutingStrategy  int
+	TLSEnabled       bool
+}
+
+// Preamble is the handshake a plugin prints to snapteld on startup.
+type Preamble struct {
+	Meta          Meta
+	ListenAddress string
+	PprofAddress  string
+	Type          int
+	State         int
+	ErrorMessage  string
+}
+
+// ParsePreamble decodes the preamble JSON printed by a plugin.
+func ParsePreamble(s string) (Preamble, error) {
+	var p Preamble
+	err := json.Unmarshal([]byte(s), &p)
+	return p, err
+}
+
+// Harness is a plugin served in-process over gRPC, together with a client
+// connection to it.
+type Harness struct {
+	// Preamble is the parsed handshake of the served plugin.
+	Preamble Preamble
+	// Conn is the client connection to the plugin.
+	Conn *grpc.ClientConn
+
+	stop func()
+}
+
+// Close tears down the client connection and stops the plugin's server.
+func (h *Harness) Close() error {
+	err := h.Conn.Close()
+	h.stop()
+	return err
+}
+
+func newHarness(p plugin.Plugin, name string, version int, opts ...plugin.MetaOpt) (*Harness, error) {
+	lis := newMemListener()
+	preamble, stop, err := plugin.ServePlugin(lis, p, name, version, opts...)
+	if err != nil {
+		return nil, err
+	}
+	h := &Harness{stop: stop}
+	if h.Preamble, err = ParsePreamble(preamble); err != nil {
+		stop()
+		return nil, err
+	}
+	h.Conn, err = grpc.Dial(lis.Addr().String(),
+		grpc.WithInsecure(),
+		grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+			return lis.dial()
+		}))
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	return h, nil
+}
+
+// Collector is a harness serving a plugin.Collector.
+type Collector struct {
+	*Harness
+	rpc.CollectorClient
+}
+
+// NewCollector serves the given collector in-process and returns a client
+// for it.
+func NewCollector(c plugin.Collector, name string, version int, opts ...plugin.MetaOpt) (*Collector, error) {
+	h, err := newHarness(c, name, version, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Collector{Harness: h, CollectorClient: rpc.NewCollectorClient(h.Conn)}, nil
+}
+
+// Processor is a harness serving a plugin.Processor.
+type Processor struct {
+	*Harness
+	rpc.ProcessorClient
+}
+
+// NewProcessor serves the given processor in-process and returns a client
+// for it.
+func NewProcessor(p plugin.Processor, name string, version int, opts ...plugin.MetaOpt) (*Processor, error) {
+	h, err := newHarness(p, name, version, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Processor{Harness: h, ProcessorClient: rpc.NewProcessorClient(h.Conn)}, nil
+}
+
+// Publisher is a harness serving a plugin.Publisher.
+type Publisher struct {
+	*Harness
+	rpc.PublisherClient
+}
+
+// NewPublisher serves the given publisher in-process and returns a client
+// for it.
+func NewPublisher(p plugin.Publisher, name string, version int, opts ...plugin.MetaOpt) (*Publisher, error) {
+	h, err := newHarness(p, name, version, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Publisher{Harness: h, PublisherClient: rpc.NewPublisherClient(h.Conn)}, nil
+}
+
+// StreamCollector is a harness serving a plugin.StreamCollector.
+type StreamCollector struct {
+	*Harness
+	rpc.StreamCollectorClient
+}
+
+// NewStreamCollector serves the given streaming collector in-process and
+// returns a client for it.
+func NewStreamCollector(s plugin.StreamCollector, name string, version int, opts ...plugin.MetaOpt) (*StreamCollector, error) {
+	h, err := newHarness(s, name, version, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamCollector{Harness: h, StreamCollectorClient: rpc.NewStreamCollectorClient(h.Conn)}, nil
+}
@@ -0,0 +1,245 @@
+// +build medium
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugintest
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin/rpc"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testPlugin struct{}
+
+func (testPlugin) GetConfigPolicy() (plugin.ConfigPolicy, error) {
+	policy := plugin.NewConfigPolicy()
+	policy.AddNewIntRule([]string{"test"}, "limit", false, plugin.SetDefaultInt(10))
+	return *policy, nil
+}
+
+type testCollector struct {
+	testPlugin
+}
+
+func (testCollector) GetMetricTypes(plugin.Config) ([]plugin.Metric, error) {
+	return []plugin.Metric{
+		{Namespace: plugin.NewNamespace("test", "int")},
+		{Namespace: plugin.NewNamespace("test", "unsupported")},
+	}, nil
+}
+
+func (testCollector) CollectMetrics(mts []plugin.Metric) ([]plugin.Metric, error) {
+	for i := range mts {
+		switch mts[i].Namespace.Element(1).Value {
+		case "int":
+			mts[i].Data = 42
+		case "unsupported":
+			mts[i].Data = struct{}{}
+		}
+	}
+	return mts, nil
+}
+
+type testProcessor struct {
+	testPlugin
+}
+
+func (testProcessor) Process(mts []plugin.Metric, cfg plugin.Config) ([]plugin.Metric, error) {
+	for i := range mts {
+		mts[i].Data = mts[i].Namespace.String()
+	}
+	return mts, nil
+}
+
+type testPublisher struct {
+	testPlugin
+}
+
+func (testPublisher) Publish(mts []plugin.Metric, cfg plugin.Config) error {
+	if _, err := cfg.GetString("fail"); err == nil {
+		return errors.New("publish failed")
+	}
+	return nil
+}
+
+type testStreamCollector struct {
+	testPlugin
+}
+
+func (testStreamCollector) GetMetricTypes(plugin.Config) ([]plugin.Metric, error) {
+	return []plugin.Metric{{Namespace: plugin.NewNamespace("test", "stream")}}, nil
+}
+
+func (testStreamCollector) StreamMetrics(ctx context.Context, in chan []plugin.Metric, out chan []plugin.Metric, _ chan string) error {
+	for {
+		select {
+		case mts := <-in:
+			for i := range mts {
+				mts[i].Data = int64(7)
+			}
+			out <- mts
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func TestCollector(t *testing.T) {
+	Convey("Having a collector served by the harness", t, func() {
+		c, err := NewCollector(testCollector{}, "test-collector", 3, plugin.ConcurrencyCount(2))
+		So(err, ShouldBeNil)
+		defer c.Close()
+
+		Convey("preamble should describe the plugin", func() {
+			So(c.Preamble.Meta.Name, ShouldEqual, "test-collector")
+			So(c.Preamble.Meta.Version, ShouldEqual, 3)
+			So(c.Preamble.Meta.ConcurrencyCount, ShouldEqual, 2)
+			So(c.Preamble.State, ShouldEqual, 0)
+		})
+		Convey("config policy should be served", func() {
+			reply, err := c.GetConfigPolicy(context.Background(), &rpc.Empty{})
+			So(err, ShouldBeNil)
+			So(reply.IntegerPolicy["test"].Rules["limit"].Default, ShouldEqual, 10)
+		})
+		Convey("metric types should be served", func() {
+			reply, err := c.GetMetricTypes(context.Background(), &rpc.GetMetricTypesArg{})
+			So(err, ShouldBeNil)
+			_, ok := FindMetric(reply, "test", "int")
+			So(ok, ShouldBeTrue)
+		})
+		Convey("collected data should be converted for the wire", func() {
+			reply, err := c.CollectMetrics(context.Background(), &rpc.MetricsArg{
+				Metrics: []*rpc.Metric{NewMetric([]string{"test", "int"}, plugin.Config{"limit": 5})},
+			})
+			So(err, ShouldBeNil)
+			So(ReplyData(reply), ShouldResemble, map[string]interface{}{"/test/int": int64(42)})
+		})
+		Convey("unsupported data should fail the call", func() {
+			_, err := c.CollectMetrics(context.Background(), &rpc.MetricsArg{
+				Metrics: []*rpc.Metric{NewMetric([]string{"test", "unsupported"}, nil)},
+			})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "unsupported type")
+		})
+	})
+}
+
+func TestProcessor(t *testing.T) {
+	Convey("Having a processor served by the harness", t, func() {
+		p, err := NewProcessor(testProcessor{}, "test-processor", 1)
+		So(err, ShouldBeNil)
+		defer p.Close()
+
+		reply, err := p.Process(context.Background(), &rpc.PubProcArg{
+			Metrics: []*rpc.Metric{NewMetric([]string{"a", "b"}, nil)},
+		})
+		So(err, ShouldBeNil)
+		So(ReplyData(reply), ShouldResemble, map[string]interface{}{"/a/b": "/a/b"})
+	})
+}
+
+func TestPublisher(t *testing.T) {
+	Convey("Having a publisher served by the harness", t, func() {
+		p, err := NewPublisher(testPublisher{}, "test-publisher", 1)
+		So(err, ShouldBeNil)
+		defer p.Close()
+
+		Convey("successful publish should reply without error", func() {
+			reply, err := p.Publish(context.Background(), &rpc.PubProcArg{
+				Metrics: []*rpc.Metric{NewMetric([]string{"a"}, nil)},
+			})
+			So(err, ShouldBeNil)
+			So(reply.Error, ShouldBeEmpty)
+		})
+		Convey("failed publish should report the error", func() {
+			cm, err := ConfigMap(plugin.Config{"fail": "yes"})
+			So(err, ShouldBeNil)
+			reply, err := p.Publish(context.Background(), &rpc.PubProcArg{
+				Config: cm,
+			})
+			So(err, ShouldBeNil)
+			So(reply.Error, ShouldEqual, "publish failed")
+		})
+	})
+}
+
+func TestConfigMap(t *testing.T) {
+	Convey("Converting config for the wire", t, func() {
+		cm, err := ConfigMap(plugin.Config{"i": 1, "u": uint64(math.MaxInt64), "s": "a", "f": 1.5, "b": true, "x": []int{}})
+		So(err, ShouldBeNil)
+		So(cm.IntMap, ShouldResemble, map[string]int64{"i": 1, "u": math.MaxInt64})
+		So(cm.StringMap, ShouldResemble, map[string]string{"s": "a"})
+		So(cm.FloatMap, ShouldResemble, map[string]float64{"f": 1.5})
+		So(cm.BoolMap, ShouldResemble, map[string]bool{"b": true})
+
+		_, err = ConfigMap(plugin.Config{"u": uint64(math.MaxInt64) + 1})
+		So(err, ShouldNotBeNil)
+		So(func() { NewMetric(nil, plugin.Config{"u": uint64(math.MaxUint64)}) }, ShouldPanic)
+	})
+}
+
+func TestStreamCollector(t *testing.T) {
+	Convey("Having a streaming collector served by the harness", t, func() {
+		s, err := NewStreamCollector(testStreamCollector{}, "test-stream", 1)
+		So(err, ShouldBeNil)
+		defer s.Close()
+
+		So(s.Preamble.Meta.RPCType, ShouldEqual, 3)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stream, err := s.StreamMetrics(ctx)
+		So(err, ShouldBeNil)
+		err = stream.Send(&rpc.CollectArg{
+			Metrics_Arg: &rpc.MetricsArg{
+				Metrics: []*rpc.Metric{NewMetric([]string{"test", "stream"}, nil)},
+			},
+		})
+		So(err, ShouldBeNil)
+		reply, err := stream.Recv()
+		So(err, ShouldBeNil)
+		So(ReplyData(reply.Metrics_Reply), ShouldResemble, map[string]interface{}{"/test/stream": int64(7)})
+	})
+}
+
+func TestKill(t *testing.T) {
+	Convey("Killing a plugin served by the harness should stop its server", t, func() {
+		c, err := NewCollector(testCollector{}, "test-collector", 1)
+		So(err, ShouldBeNil)
+		defer c.Close()
+
+		_, err = c.Kill(context.Background(), &rpc.KillArg{Reason: "test"})
+		So(err, ShouldBeNil)
+		for i := 0; i < 50; i++ {
+			if _, err = c.Ping(context.Background(), &rpc.Empty{}); err != nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,141 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugintest
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin/rpc"
+)
+
+// NewMetric builds a metric request the way snapteld does, with the given
+// namespace values and config. It panics if the config cannot be converted
+// by ConfigMap.
+func NewMetric(ns []string, cfg plugin.Config) *rpc.Metric {
+	cm, err := ConfigMap(cfg)
+	if err != nil {
+		panic(err)
+	}
+	now := time.Now()
+	elements := make([]*rpc.NamespaceElement, 0, len(ns))
+	for _, v := range ns {
+		elements = append(elements, &rpc.NamespaceElement{Value: v})
+	}
+	return &rpc.Metric{
+		Namespace:          elements,
+		Config:             cm,
+		Timestamp:          &rpc.Time{Sec: now.Unix(), Nsec: int64(now.Nanosecond())},
+		LastAdvertisedTime: &rpc.Time{Sec: now.Unix(), Nsec: int64(now.Nanosecond())},
+	}
+}
+
+// ConfigMap converts a plugin config into its wire representation. Values of
+// unsupported types are skipped, unsigned integers which do not fit in an
+// int64 result in an error.
+func ConfigMap(cfg plugin.Config) (*rpc.ConfigMap, error) {
+	cm := &rpc.ConfigMap{
+		IntMap:    map[string]int64{},
+		StringMap: map[string]string{},
+		FloatMap:  map[string]float64{},
+		BoolMap:   map[string]bool{},
+	}
+	for k, v := range cfg {
+		val := reflect.ValueOf(v)
+		switch val.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			cm.IntMap[k] = val.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if val.Uint() > math.MaxInt64 {
+				return nil, fmt.Errorf("config item %q: %v overflows int64", k, val.Uint())
+			}
+			cm.IntMap[k] = int64(val.Uint())
+		case reflect.Float32, reflect.Float64:
+			cm.FloatMap[k] = val.Float()
+		case reflect.String:
+			cm.StringMap[k] = val.String()
+		case reflect.Bool:
+			cm.BoolMap[k] = val.Bool()
+		}
+	}
+	return cm, nil
+}
+
+// Namespace returns the namespace values of a metric joined with "/" and
+// with a leading "/".
+func Namespace(m *rpc.Metric) string {
+	values := make([]string, 0, len(m.Namespace))
+	for _, e := range m.Namespace {
+		values = append(values, e.Value)
+	}
+	return "/" + strings.Join(values, "/")
+}
+
+// Data returns the value carried by a metric, unwrapped from the oneof it
+// was sent in.
+func Data(m *rpc.Metric) interface{} {
+	switch d := m.Data.(type) {
+	case *rpc.Metric_StringData:
+		return d.StringData
+	case *rpc.Metric_Float32Data:
+		return d.Float32Data
+	case *rpc.Metric_Float64Data:
+		return d.Float64Data
+	case *rpc.Metric_Int32Data:
+		return d.Int32Data
+	case *rpc.Metric_Int64Data:
+		return d.Int64Data
+	case *rpc.Metric_Uint32Data:
+		return d.Uint32Data
+	case *rpc.Metric_Uint64Data:
+		return d.Uint64Data
+	case *rpc.Metric_BytesData:
+		return d.BytesData
+	case *rpc.Metric_BoolData:
+		return d.BoolData
+	}
+	return nil
+}
+
+// ReplyData maps the namespace of every metric in the reply, as returned by
+// Namespace, to its data. Metrics sharing a namespace overwrite each other.
+func ReplyData(reply *rpc.MetricsReply) map[string]interface{} {
+	data := map[string]interface{}{}
+	for _, m := range reply.GetMetrics() {
+		data[Namespace(m)] = Data(m)
+	}
+	return data
+}
+
+// FindMetric returns the first metric in the reply with the given namespace
+// values.
+func FindMetric(reply *rpc.MetricsReply, ns ...string) (*rpc.Metric, bool) {
+	want := "/" + strings.Join(ns, "/")
+	for _, m := range reply.GetMetrics() {
+		if Namespace(m) == want {
+			return m, true
+		}
+	}
+	return nil, false
+}
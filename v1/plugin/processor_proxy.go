@@ -40,7 +40,14 @@ func (p *processorProxy) Process(ctx context.Context, arg *rpc.PubProcArg) (*rpc
 		metrics = append(metrics, metric)
 	}
 	cfg := fromProtoConfig(arg.Config)
-	r, err := p.plugin.Process(metrics, cfg)
+	if err := p.checkConfig(cfg); err != nil {
+		return nil, err
+	}
+	ctx = withTask(ctx)
+	if err := p.trackTask(ctx, cfg); err != nil {
+		return nil, err
+	}
+	r, err := process(ctx, p.plugin, metrics, cfg)
 	if err != nil {
 		return nil, err
 	}
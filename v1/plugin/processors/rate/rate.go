@@ -0,0 +1,246 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rate provides a processor converting cumulative counters into
+// per-second rates.
+//
+// Processor can be run as a processor plugin of its own:
+//
+//	plugin.StartProcessor(&rate.Processor{}, "rate", 1)
+//
+// or embedded in the processor of a plugin, which calls its Process method
+// before or after its own processing.
+package rate
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	// SuffixKey is the config key of the namespace element appended to the
+	// namespace of rates. Rates keep the namespace of their counter if it
+	// is empty.
+	SuffixKey = "suffix"
+	// DropFirstKey is the config key telling whether the first sample of a
+	// series is dropped, as no rate can be computed for it. Otherwise it is
+	// sent with a rate of 0.
+	DropFirstKey = "drop_first"
+
+	defaultSuffix    = "rate"
+	defaultDropFirst = true
+
+	// DefaultSeriesTTL is the SeriesTTL of a Processor leaving it zero.
+	DefaultSeriesTTL = 10 * time.Minute
+)
+
+// Processor converts counters into per-second rates. It keeps the previous
+// sample of each series, a namespace with a set of tags, between calls of
+// Process.
+//
+// Metrics of kind plugin.KindCounter or plugin.KindUnknown holding a number
+// are treated as counters. Metrics of kind plugin.KindDelta are divided by
+// the time since the previous sample. Rates are float64 metrics of kind
+// plugin.KindGauge, with "/s" appended to the unit. Gauges and metrics
+// holding other data are passed through unchanged. Samples which are not
+// newer than the previous sample of their series are dropped.
+//
+// When a counter decreases, it is assumed to have wrapped around if it is
+// an unsigned integer dropping from the upper half of its range to the
+// lower half, and to have been reset to 0 otherwise.
+//
+// Series without new samples for SeriesTTL are forgotten, so that the
+// series of gone metrics, like those of removed devices or ended tasks, do
+// not pile up. Time is that of the samples: a series is forgotten once a
+// sample of another series is newer by SeriesTTL than its last sample.
+//
+// The zero value is ready to use. A Processor must not be copied after
+// first use.
+type Processor struct {
+	// SeriesTTL is the time after which a series without new samples is
+	// forgotten, DefaultSeriesTTL if zero.
+	SeriesTTL time.Duration
+
+	mtx    sync.Mutex
+	series map[string]sample
+	// latest is the timestamp of the newest sample seen.
+	latest time.Time
+	// evicted is the value of latest when series were last evicted.
+	evicted time.Time
+}
+
+// sample is the previous sample of a series.
+type sample struct {
+	value      float64
+	unsigned   uint64
+	bits       int
+	isUnsigned bool
+	timestamp  time.Time
+}
+
+// GetConfigPolicy returns the config policy of the processor.
+func (p *Processor) GetConfigPolicy() (plugin.ConfigPolicy, error) {
+	policy := plugin.NewConfigPolicy()
+	policy.AddNewStringRule([]string{""}, SuffixKey, false, plugin.SetDefaultString(defaultSuffix))
+	policy.AddNewBoolRule([]string{""}, DropFirstKey, false, plugin.SetDefaultBool(defaultDropFirst))
+	return *policy, nil
+}
+
+// Process converts the counters of mts into rates.
+func (p *Processor) Process(mts []plugin.Metric, cfg plugin.Config) ([]plugin.Metric, error) {
+	suffix, err := cfg.GetString(SuffixKey)
+	if err == plugin.ErrConfigNotFound {
+		suffix = defaultSuffix
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %v", SuffixKey, err)
+	}
+	dropFirst, err := cfg.GetBool(DropFirstKey)
+	if err == plugin.ErrConfigNotFound {
+		dropFirst = defaultDropFirst
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %v", DropFirstKey, err)
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.series == nil {
+		p.series = map[string]sample{}
+	}
+
+	metrics := []plugin.Metric{}
+	for _, mt := range mts {
+		cur, ok := newSample(mt)
+		if !ok || mt.Kind == plugin.KindGauge {
+			metrics = append(metrics, mt)
+			continue
+		}
+		key := seriesKey(mt)
+		prev, seen := p.series[key]
+		if seen && !cur.timestamp.After(prev.timestamp) {
+			// out of order or repeated sample
+			continue
+		}
+		p.series[key] = cur
+		if cur.timestamp.After(p.latest) {
+			p.latest = cur.timestamp
+		}
+
+		var rate float64
+		switch {
+		case !seen && dropFirst:
+			continue
+		case !seen:
+		case mt.Kind == plugin.KindDelta:
+			rate = cur.value / cur.timestamp.Sub(prev.timestamp).Seconds()
+		default:
+			rate = increase(prev, cur) / cur.timestamp.Sub(prev.timestamp).Seconds()
+		}
+
+		mt.Data = rate
+		mt.Kind = plugin.KindGauge
+		if suffix != "" {
+			mt.Namespace = plugin.CopyNamespace(mt.Namespace).AddStaticElement(suffix)
+		}
+		if mt.Unit != "" {
+			mt.Unit += "/s"
+		}
+		metrics = append(metrics, mt)
+	}
+	p.evict()
+	return metrics, nil
+}
+
+// evict forgets the series without new samples for SeriesTTL. Series are
+// looked at once per SeriesTTL, so they are kept for up to twice as long.
+func (p *Processor) evict() {
+	ttl := p.SeriesTTL
+	if ttl <= 0 {
+		ttl = DefaultSeriesTTL
+	}
+	if p.latest.Sub(p.evicted) < ttl {
+		return
+	}
+	for key, s := range p.series {
+		if p.latest.Sub(s.timestamp) >= ttl {
+			delete(p.series, key)
+		}
+	}
+	p.evicted = p.latest
+}
+
+// newSample returns the sample of the metric, if it holds a number.
+func newSample(mt plugin.Metric) (sample, bool) {
+	s := sample{timestamp: mt.Timestamp}
+	if s.timestamp.IsZero() {
+		s.timestamp = time.Now()
+	}
+	rv := reflect.ValueOf(mt.Data)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s.value = float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s.unsigned = rv.Uint()
+		s.bits = rv.Type().Bits()
+		s.isUnsigned = true
+		s.value = float64(s.unsigned)
+	case reflect.Float32, reflect.Float64:
+		s.value = rv.Float()
+	default:
+		return s, false
+	}
+	return s, true
+}
+
+// increase returns the increase of a counter from prev to cur.
+func increase(prev, cur sample) float64 {
+	if cur.isUnsigned && prev.isUnsigned && cur.bits == prev.bits {
+		max := uint64(1<<uint(cur.bits) - 1)
+		switch {
+		case cur.unsigned >= prev.unsigned:
+			return float64(cur.unsigned - prev.unsigned)
+		case prev.unsigned > max/2 && cur.unsigned <= max/2:
+			return float64(max - prev.unsigned + cur.unsigned + 1)
+		}
+		return cur.value
+	}
+	if cur.value >= prev.value {
+		return cur.value - prev.value
+	}
+	return cur.value
+}
+
+// seriesKey identifies the series of a metric by its namespace and tags.
+func seriesKey(mt plugin.Metric) string {
+	keys := make([]string, 0, len(mt.Tags))
+	for k := range mt.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := []string{mt.Namespace.String()}
+	for _, k := range keys {
+		parts = append(parts, k+"="+mt.Tags[k])
+	}
+	return strings.Join(parts, "\x00")
+}
@@ -0,0 +1,141 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rate
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProcess(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	counter := func(data interface{}, after time.Duration, tags map[string]string) plugin.Metric {
+		return plugin.Metric{
+			Namespace: plugin.NewNamespace("net", "bytes"),
+			Data:      data,
+			Timestamp: start.Add(after),
+			Tags:      tags,
+			Unit:      "B",
+		}
+	}
+	process := func(p *Processor, cfg plugin.Config, mts ...plugin.Metric) []plugin.Metric {
+		out, err := p.Process(mts, cfg)
+		So(err, ShouldBeNil)
+		return out
+	}
+
+	Convey("Test rate processor", t, func() {
+		p := &Processor{}
+		cfg := plugin.Config{}
+
+		Convey("first samples should be dropped by default", func() {
+			So(process(p, cfg, counter(uint64(100), 0, nil)), ShouldBeEmpty)
+			out := process(p, cfg, counter(uint64(300), 10*time.Second, nil))
+			So(out, ShouldHaveLength, 1)
+			So(out[0].Data, ShouldEqual, 20.0)
+			So(out[0].Namespace.String(), ShouldEqual, "/net/bytes/rate")
+			So(out[0].Kind, ShouldEqual, plugin.KindGauge)
+			So(out[0].Unit, ShouldEqual, "B/s")
+		})
+		Convey("first samples should be sent as 0 if configured", func() {
+			cfg := plugin.Config{DropFirstKey: false, SuffixKey: ""}
+			out := process(p, cfg, counter(uint64(100), 0, nil))
+			So(out, ShouldHaveLength, 1)
+			So(out[0].Data, ShouldEqual, 0.0)
+			So(out[0].Namespace.String(), ShouldEqual, "/net/bytes")
+		})
+		Convey("series should be told apart by tags", func() {
+			process(p, cfg, counter(int64(0), 0, map[string]string{"if": "eth0"}), counter(int64(0), 0, map[string]string{"if": "eth1"}))
+			out := process(p, cfg, counter(int64(10), time.Second, map[string]string{"if": "eth0"}), counter(int64(20), time.Second, map[string]string{"if": "eth1"}))
+			So(out, ShouldHaveLength, 2)
+			So(out[0].Data, ShouldEqual, 10.0)
+			So(out[1].Data, ShouldEqual, 20.0)
+		})
+		Convey("unsigned counters should wrap around", func() {
+			process(p, cfg, counter(uint32(math.MaxUint32-9), 0, nil))
+			out := process(p, cfg, counter(uint32(10), 2*time.Second, nil))
+			So(out[0].Data, ShouldEqual, 10.0)
+
+			process(p, cfg, counter(uint64(math.MaxUint64), 3*time.Second, nil))
+			out = process(p, cfg, counter(uint64(1), 4*time.Second, nil))
+			So(out[0].Data, ShouldEqual, 2.0)
+		})
+		Convey("counters should be reset", func() {
+			process(p, cfg, counter(uint64(1000), 0, nil))
+			out := process(p, cfg, counter(uint64(10), time.Second, nil))
+			So(out[0].Data, ShouldEqual, 10.0)
+
+			process(p, cfg, counter(5.5, 2*time.Second, nil))
+			out = process(p, cfg, counter(1.5, 3*time.Second, nil))
+			So(out[0].Data, ShouldEqual, 1.5)
+		})
+		Convey("deltas should be divided by the interval", func() {
+			delta := counter(int64(0), 0, nil)
+			delta.Kind = plugin.KindDelta
+			process(p, cfg, delta)
+			delta = counter(int64(-30), 3*time.Second, nil)
+			delta.Kind = plugin.KindDelta
+			out := process(p, cfg, delta)
+			So(out[0].Data, ShouldEqual, -10.0)
+		})
+		Convey("repeated samples should be dropped", func() {
+			process(p, cfg, counter(uint64(1), 0, nil))
+			So(process(p, cfg, counter(uint64(2), 0, nil)), ShouldBeEmpty)
+		})
+		Convey("gauges and other data should be passed through", func() {
+			gauge := counter(uint64(1), 0, nil)
+			gauge.Kind = plugin.KindGauge
+			out := process(p, cfg, gauge, counter("up", 0, nil))
+			So(out, ShouldHaveLength, 2)
+			So(out[0].Data, ShouldEqual, uint64(1))
+			So(out[1].Data, ShouldEqual, "up")
+		})
+		Convey("series without new samples should be forgotten", func() {
+			p.SeriesTTL = time.Minute
+			eth0 := map[string]string{"if": "eth0"}
+			eth1 := map[string]string{"if": "eth1"}
+			process(p, cfg, counter(int64(0), 0, eth0), counter(int64(0), 0, eth1))
+			So(process(p, cfg, counter(int64(60), 30*time.Second, eth1)), ShouldHaveLength, 1)
+			So(p.series, ShouldHaveLength, 2)
+			So(process(p, cfg, counter(int64(120), 90*time.Second, eth1)), ShouldHaveLength, 1)
+			So(p.series, ShouldHaveLength, 1)
+			So(process(p, cfg, counter(int64(100), 91*time.Second, eth0)), ShouldBeEmpty)
+		})
+		Convey("invalid config should be rejected", func() {
+			_, err := p.Process(nil, plugin.Config{SuffixKey: 1})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestGetConfigPolicy(t *testing.T) {
+	Convey("Config policy should hold the defaults of the processor", t, func() {
+		policy, err := (&Processor{}).GetConfigPolicy()
+		So(err, ShouldBeNil)
+		So(policy.Validate(plugin.Config{SuffixKey: "rate", DropFirstKey: true}), ShouldBeEmpty)
+		So(policy.Validate(plugin.Config{DropFirstKey: "yes"}), ShouldHaveLength, 1)
+	})
+}
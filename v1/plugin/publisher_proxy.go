@@ -40,7 +40,14 @@ func (p *publisherProxy) Publish(ctx context.Context, arg *rpc.PubProcArg) (*rpc
 		metrics = append(metrics, metric)
 	}
 	cfg := fromProtoConfig(arg.Config)
-	err := p.plugin.Publish(metrics, cfg)
+	if err := p.checkConfig(cfg); err != nil {
+		return nil, err
+	}
+	ctx = withTask(ctx)
+	if err := p.trackTask(ctx, cfg); err != nil {
+		return &rpc.ErrReply{Error: err.Error()}, nil
+	}
+	err := publish(ctx, p.plugin, metrics, cfg)
 	if err != nil {
 		return &rpc.ErrReply{Error: err.Error()}, nil
 	}
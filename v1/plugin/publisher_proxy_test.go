@@ -22,9 +22,12 @@ limitations under the License.
 package plugin
 
 import (
+	"errors"
 	"testing"
 
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin/rpc"
 	. "github.com/smartystreets/goconvey/convey"
@@ -53,6 +56,63 @@ func TestPublisher(t *testing.T) {
 			_, err = pp.Publish(context.Background(), &rpc.PubProcArg{Metrics: input})
 			So(err, ShouldBeNil)
 		})
+		Convey("Config breaking config policy", func() {
+			pp := publisherProxy{
+				pluginProxy: *newPluginProxy(newMockPublisher()),
+				plugin:      newMockPublisher(),
+			}
+			cfg := &rpc.ConfigMap{StringMap: map[string]string{"low": "x"}}
+
+			Convey("is passed to the plugin by default", func() {
+				_, err := pp.Publish(context.Background(), &rpc.PubProcArg{Config: cfg})
+				So(err, ShouldBeNil)
+			})
+			Convey("is rejected with validation enabled", func() {
+				pp.validateConfig = true
+				_, err := pp.Publish(context.Background(), &rpc.PubProcArg{Config: cfg})
+				So(err, ShouldNotBeNil)
+				st, _ := status.FromError(err)
+				So(st.Code(), ShouldEqual, codes.InvalidArgument)
+				So(st.Message(), ShouldContainSubstring, `namespace "float", key "low": expected float, got string`)
+			})
+		})
+		Convey("Config breaking string rule constraints", func() {
+			cp := NewConfigPolicy()
+			So(cp.AddNewStringRule([]string{"net"}, "protocol", true, SetAllowedStrings("tcp", "udp")), ShouldBeNil)
+			pub := &constrainedPublisher{mockPublisher: newMockPublisher(), policy: *cp}
+			pp := publisherProxy{
+				pluginProxy: *newPluginProxy(pub),
+				plugin:      pub,
+			}
+
+			Convey("is rejected even with validation disabled", func() {
+				cfg := &rpc.ConfigMap{StringMap: map[string]string{"protocol": "http"}}
+				_, err := pp.Publish(context.Background(), &rpc.PubProcArg{Config: cfg})
+				So(err, ShouldNotBeNil)
+				st, _ := status.FromError(err)
+				So(st.Code(), ShouldEqual, codes.InvalidArgument)
+				So(st.Message(), ShouldContainSubstring, `namespace "net", key "protocol": "http" is not one of ["tcp", "udp"]`)
+			})
+			Convey("does not check other rules with validation disabled", func() {
+				_, err := pp.Publish(context.Background(), &rpc.PubProcArg{Config: &rpc.ConfigMap{}})
+				So(err, ShouldBeNil)
+			})
+			Convey("is checked against the policy got once", func() {
+				pp.Publish(context.Background(), &rpc.PubProcArg{Config: &rpc.ConfigMap{}})
+				pp.Publish(context.Background(), &rpc.PubProcArg{Config: &rpc.ConfigMap{}})
+				So(pub.calls, ShouldEqual, 1)
+			})
+		})
+		Convey("Failing to get the config policy", func() {
+			pub := &constrainedPublisher{mockPublisher: newMockPublisher(), err: errors.New("no policy")}
+			pp := publisherProxy{
+				pluginProxy: *newPluginProxy(pub),
+				plugin:      pub,
+			}
+			_, err := pp.Publish(context.Background(), &rpc.PubProcArg{Config: &rpc.ConfigMap{}})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "no policy")
+		})
 	})
 }
 
@@ -69,3 +129,16 @@ func getTestData() ([]*rpc.Metric, error) {
 	}
 	return input, nil
 }
+
+// constrainedPublisher is a mock publisher with a given config policy.
+type constrainedPublisher struct {
+	*mockPublisher
+	policy ConfigPolicy
+	err    error
+	calls  int
+}
+
+func (c *constrainedPublisher) GetConfigPolicy() (ConfigPolicy, error) {
+	c.calls++
+	return c.policy, c.err
+}
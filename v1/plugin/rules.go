@@ -19,7 +19,15 @@ limitations under the License.
 
 package plugin
 
-import "github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin/rpc"
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin/rpc"
+)
 
 type boolRuleOpt func(*rpc.BoolRule)
 
@@ -97,14 +105,191 @@ func SetMinInt(min int64) integerRuleOpt {
 	}
 }
 
-type stringRuleOpt func(*rpc.StringRule)
+type stringRuleOpt func(*stringRule)
+
+// stringRule is an rpc.StringRule together with the constraints which
+// rpc.StringRule cannot carry. The constraints are kept by the ConfigPolicy,
+// so they are shown by diagnostics and checked by ConfigPolicy.Validate,
+// but they are not sent to snapteld.
+type stringRule struct {
+	*rpc.StringRule
+	*stringConstraints
+}
+
+// stringConstraints restrict the values allowed by a string rule.
+type stringConstraints struct {
+	allowed   []string
+	pattern   string
+	re        *regexp.Regexp
+	minLength int
+	maxLength int
+	hasMinLen bool
+	hasMaxLen bool
+
+	// format is the encoding of durations, lists and maps, see
+	// AddNewDurationRule, AddNewStringSliceRule and AddNewStringMapRule.
+	format         stringFormat
+	minDuration    time.Duration
+	maxDuration    time.Duration
+	hasMinDuration bool
+	hasMaxDuration bool
+
+	// err is the error of an option, returned by AddNewStringRule.
+	err error
+}
 
 // SetDefaultString Allows easy setting of the Default value for an rpc.StringRule.
 // Usage:
 //		AddNewStringRule(ns, key, req, config.SetDefaultString(default))
 func SetDefaultString(in string) stringRuleOpt {
-	return func(i *rpc.StringRule) {
+	return func(i *stringRule) {
 		i.Default = in
 		i.HasDefault = true
 	}
 }
+
+// SetAllowedStrings restricts the values of a string rule to the given ones.
+// Usage:
+//		AddNewStringRule(ns, key, req, config.SetAllowedStrings("tcp", "udp"))
+func SetAllowedStrings(values ...string) stringRuleOpt {
+	return func(i *stringRule) {
+		i.allowed = values
+	}
+}
+
+// SetStringPattern restricts the values of a string rule to those matching
+// the regular expression pattern. The pattern is not anchored, use ^ and $
+// to match whole values. AddNewStringRule fails if the pattern is invalid.
+// Usage:
+//		AddNewStringRule(ns, key, req, config.SetStringPattern(`^[a-z]+$`))
+func SetStringPattern(pattern string) stringRuleOpt {
+	return func(i *stringRule) {
+		i.pattern = pattern
+	}
+}
+
+// SetMinStringLength sets the minimum length, in characters, of the values
+// of a string rule.
+// Usage:
+//		AddNewStringRule(ns, key, req, config.SetMinStringLength(min))
+func SetMinStringLength(min int) stringRuleOpt {
+	return func(i *stringRule) {
+		i.minLength = min
+		i.hasMinLen = true
+	}
+}
+
+// SetMaxStringLength sets the maximum length, in characters, of the values
+// of a string rule.
+// Usage:
+//		AddNewStringRule(ns, key, req, config.SetMaxStringLength(max))
+func SetMaxStringLength(max int) stringRuleOpt {
+	return func(i *stringRule) {
+		i.maxLength = max
+		i.hasMaxLen = true
+	}
+}
+
+// empty tells whether no constraint is set.
+func (s *stringConstraints) empty() bool {
+	return len(s.allowed) == 0 && s.pattern == "" && !s.hasMinLen && !s.hasMaxLen && s.format == ""
+}
+
+// check returns the name of the first constraint broken by val, with a
+// description of how it is broken.
+func (s *stringConstraints) check(val string) (rule, reason string, ok bool) {
+	switch s.format {
+	case durationFormat:
+		d, err := Config{"": val}.GetDuration("")
+		if err != nil {
+			return "type", fmt.Sprintf("%q is not a duration", val), false
+		}
+		if s.hasMinDuration && d < s.minDuration {
+			return "minimum", fmt.Sprintf("%v is below minimum %v", d, s.minDuration), false
+		}
+		if s.hasMaxDuration && d > s.maxDuration {
+			return "maximum", fmt.Sprintf("%v is above maximum %v", d, s.maxDuration), false
+		}
+	case listFormat:
+		if _, err := decodeStringSlice(val); err != nil {
+			return "type", fmt.Sprintf("%q is not a list: %v", val, err), false
+		}
+	case mapFormat:
+		if _, err := decodeStringMap(val); err != nil {
+			return "type", fmt.Sprintf("%q is not a map: %v", val, err), false
+		}
+	}
+	if len(s.allowed) > 0 {
+		found := false
+		for _, a := range s.allowed {
+			if a == val {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "allowed", fmt.Sprintf("%q is not one of %s", val, s.allowedString()), false
+		}
+	}
+	if s.re != nil && !s.re.MatchString(val) {
+		return "pattern", fmt.Sprintf("%q does not match pattern %q", val, s.pattern), false
+	}
+	if n := utf8.RuneCountInString(val); s.hasMinLen && n < s.minLength {
+		return "min_length", fmt.Sprintf("%q is shorter than %d characters", val, s.minLength), false
+	} else if s.hasMaxLen && n > s.maxLength {
+		return "max_length", fmt.Sprintf("%q is longer than %d characters", val, s.maxLength), false
+	}
+	return "", "", true
+}
+
+// decodes tells whether val, which is not a string, is a value of the
+// format of the rule, like the lists and maps of config read from JSON.
+func (s *stringConstraints) decodes(val interface{}) bool {
+	var err error
+	switch s.format {
+	case durationFormat:
+		_, err = Config{"": val}.GetDuration("")
+	case listFormat:
+		_, err = Config{"": val}.GetStringSlice("")
+	case mapFormat:
+		_, err = Config{"": val}.GetStringMap("")
+	default:
+		return false
+	}
+	return err == nil
+}
+
+func (s *stringConstraints) allowedString() string {
+	quoted := make([]string, len(s.allowed))
+	for i, a := range s.allowed {
+		quoted[i] = fmt.Sprintf("%q", a)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// String describes the constraints for diagnostics.
+func (s *stringConstraints) String() string {
+	var parts []string
+	if s.format != "" {
+		parts = append(parts, "format: "+string(s.format))
+	}
+	if s.hasMinDuration {
+		parts = append(parts, fmt.Sprintf("min: %v", s.minDuration))
+	}
+	if s.hasMaxDuration {
+		parts = append(parts, fmt.Sprintf("max: %v", s.maxDuration))
+	}
+	if len(s.allowed) > 0 {
+		parts = append(parts, "allowed: "+strings.Join(s.allowed, "|"))
+	}
+	if s.pattern != "" {
+		parts = append(parts, "pattern: "+s.pattern)
+	}
+	if s.hasMinLen {
+		parts = append(parts, fmt.Sprintf("min length: %d", s.minLength))
+	}
+	if s.hasMaxLen {
+		parts = append(parts, fmt.Sprintf("max length: %d", s.maxLength))
+	}
+	return strings.Join(parts, ", ")
+}
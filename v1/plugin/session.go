@@ -23,6 +23,9 @@ type Arg struct {
 	// The listen port
 	ListenPort string
 
+	// Path of a unix domain socket to listen on instead of TCP
+	ListenSocket string
+
 	// enable pprof
 	Pprof bool
 
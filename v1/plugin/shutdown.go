@@ -0,0 +1,100 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ShutdownTimeout is the time a stopping plugin gives the calls in progress
+// to complete, and then again its Shutdowner hook to return. Calls still in
+// progress after it are dropped.
+var ShutdownTimeout = 10 * time.Second
+
+// Shutdowner is implemented by plugins releasing resources when they stop,
+// like buffers to flush or connections to close. Shutdown is called once the
+// calls in progress completed, with the reason the plugin stops, e.g. the
+// reason given by Snap when killing it. ctx is done when ShutdownTimeout
+// passes after Shutdown is called.
+type Shutdowner interface {
+	Shutdown(ctx context.Context, reason string) error
+}
+
+// gracefulServer is a server which can wait for the calls in progress when
+// stopping, like grpc.Server.
+type gracefulServer interface {
+	GracefulStop()
+	Stop()
+}
+
+// waitForShutdown blocks until the plugin is killed, its heartbeat expires
+// or the process gets SIGTERM or SIGINT, and then shuts the plugin down.
+func (p *pluginProxy) waitForShutdown(srv gracefulServer) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+
+	var reason string
+	select {
+	case <-p.halt:
+		reason = p.haltReason
+	case sig := <-signals:
+		reason = "received signal " + sig.String()
+	}
+	p.shutdown(srv, reason)
+}
+
+// shutdown stops srv gracefully within ShutdownTimeout, stops the tasks of
+// the plugin and calls its Shutdowner hook with a deadline of its own.
+func (p *pluginProxy) shutdown(srv gracefulServer, reason string) {
+	logger := log.WithFields(log.Fields{
+		"_block": "shutdown",
+		"reason": reason,
+	})
+	logger.Info("Plugin shutting down")
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+	timer := time.NewTimer(ShutdownTimeout)
+	select {
+	case <-stopped:
+		timer.Stop()
+	case <-timer.C:
+		logger.Warn("Calls in progress did not complete in time, dropping them")
+		srv.Stop()
+	}
+
+	p.tasks.stopAll(p.plugin)
+	if s, ok := unwrapPlugin(p.plugin).(Shutdowner); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+		if err := s.Shutdown(ctx, reason); err != nil {
+			logger.WithField("error", err).Error("Plugin failed to shut down")
+		}
+	}
+}
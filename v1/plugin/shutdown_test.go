@@ -0,0 +1,120 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin/rpc"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type mockServer struct {
+	block        chan struct{}
+	gracefulStop bool
+	stop         bool
+}
+
+func (s *mockServer) GracefulStop() {
+	s.gracefulStop = true
+	if s.block != nil {
+		<-s.block
+	}
+}
+
+func (s *mockServer) Stop() {
+	s.stop = true
+	if s.block != nil {
+		close(s.block)
+	}
+}
+
+type mockShutdownPlugin struct {
+	mockPlugin
+	reason   string
+	deadline bool
+	expired  bool
+}
+
+func (mp *mockShutdownPlugin) Shutdown(ctx context.Context, reason string) error {
+	mp.reason = reason
+	_, mp.deadline = ctx.Deadline()
+	mp.expired = ctx.Err() != nil
+	return nil
+}
+
+func TestShutdown(t *testing.T) {
+	Convey("Test plugin shutdown", t, func() {
+		mp := &mockShutdownPlugin{}
+		p := newPluginProxy(mp)
+
+		Convey("Kill should stop the server and call the hook with its reason", func() {
+			srv := &mockServer{}
+			done := make(chan struct{})
+			go func() {
+				p.waitForShutdown(srv)
+				close(done)
+			}()
+			_, err := p.Kill(context.Background(), &rpc.KillArg{Reason: "task removed"})
+			So(err, ShouldBeNil)
+			<-done
+			So(srv.gracefulStop, ShouldBeTrue)
+			So(srv.stop, ShouldBeFalse)
+			So(mp.reason, ShouldEqual, "killed: task removed")
+			So(mp.deadline, ShouldBeTrue)
+		})
+		Convey("heartbeat expiry should call the hook", func() {
+			p.PingTimeoutDuration = time.Microsecond * 200
+			go p.HeartbeatWatch()
+			p.waitForShutdown(&mockServer{})
+			So(mp.reason, ShouldEqual, "heartbeat timeout expired")
+		})
+		Convey("calls in progress should be dropped after ShutdownTimeout", func() {
+			defer func(d time.Duration) { ShutdownTimeout = d }(ShutdownTimeout)
+			ShutdownTimeout = 50 * time.Millisecond
+			srv := &mockServer{block: make(chan struct{})}
+			p.shutdown(srv, "test")
+			So(srv.stop, ShouldBeTrue)
+			So(mp.reason, ShouldEqual, "test")
+			So(mp.deadline, ShouldBeTrue)
+			So(mp.expired, ShouldBeFalse)
+		})
+		Convey("later kills should not block and keep the first reason", func() {
+			_, err := p.Kill(context.Background(), &rpc.KillArg{Reason: "first"})
+			So(err, ShouldBeNil)
+			_, err = p.Kill(context.Background(), &rpc.KillArg{Reason: "second"})
+			So(err, ShouldBeNil)
+			p.waitForShutdown(&mockServer{})
+			So(mp.reason, ShouldEqual, "killed: first")
+		})
+		Convey("kill after heartbeat expiry should not panic", func() {
+			p.PingTimeoutDuration = time.Microsecond * 200
+			p.HeartbeatWatch()
+			_, err := p.Kill(context.Background(), &rpc.KillArg{Reason: "late"})
+			So(err, ShouldBeNil)
+			p.waitForShutdown(&mockServer{})
+			So(mp.reason, ShouldEqual, "heartbeat timeout expired")
+		})
+	})
+}
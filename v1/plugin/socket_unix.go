@@ -0,0 +1,48 @@
+// +build !windows
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// listenUnix listens on a unix domain socket at path, only accessible to
+// the user running the plugin. The socket is chmod'ed right after it is
+// created rather than created under a restrictive umask, as the umask is
+// process wide and would affect files created by other goroutines.
+func listenUnix(path string) (net.Listener, error) {
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		lis.Close()
+		return nil, err
+	}
+	return lis, nil
+}
+
+// isConnRefusedErrno tells whether err is the errno of a refused connection.
+func isConnRefusedErrno(err error) bool {
+	return err == syscall.ECONNREFUSED
+}
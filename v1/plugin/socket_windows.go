@@ -0,0 +1,41 @@
+// +build windows
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"net"
+	"syscall"
+)
+
+// wsaeconnrefused is the Winsock error of a refused connection, which the
+// syscall package does not define.
+const wsaeconnrefused syscall.Errno = 10061
+
+// listenUnix listens on a unix domain socket at path. Windows ignores file
+// modes, access to the socket follows the ACL of its directory.
+func listenUnix(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
+
+// isConnRefusedErrno tells whether err is the errno of a refused connection.
+func isConnRefusedErrno(err error) bool {
+	return err == syscall.ECONNREFUSED || err == wsaeconnrefused
+}
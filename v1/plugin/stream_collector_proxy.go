@@ -5,8 +5,6 @@ import (
 	"fmt"
 	"time"
 
-	"google.golang.org/grpc/metadata"
-
 	"golang.org/x/net/context"
 
 	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin/rpc"
@@ -44,6 +42,9 @@ func (p *StreamProxy) GetMetricTypes(ctx context.Context, arg *rpc.GetMetricType
 	if err != nil {
 		return nil, err
 	}
+	if err := p.checkCatalog(r); err != nil {
+		return nil, err
+	}
 	metrics := []*rpc.Metric{}
 	for _, mt := range r {
 		// We can ignore this error since we are not returning data from GetMetricTypes.
@@ -75,25 +76,19 @@ func (p *StreamProxy) StreamMetrics(stream rpc.StreamCollector_StreamMetricsServ
 	p.sendChan = make(chan []Metric)
 	// context for communicating that the stream has been closed to the plugin author
 
-	md, ok := metadata.FromIncomingContext(stream.Context())
-	if !ok {
-		log.Debug("No metadata")
-	}
-
+	ctx := withTask(stream.Context())
 	taskID := "not-set"
-	if tempVal, ok := md["task-id"]; ok {
-		if len(tempVal) == 1 {
-			taskID = tempVal[0]
-		} else {
-			log.Debug("Skipping assignment of metadata")
-		}
+	if task, ok := TaskFromContext(ctx); ok {
+		taskID = task.ID
+	} else {
+		log.Debug("No task id in metadata")
 	}
 
 	go p.metricSend(taskID, p.sendChan, stream)
 	go p.errorSend(p.errChan, stream)
 	go p.streamRecv(taskID, p.recvChan, stream)
 
-	return p.plugin.StreamMetrics(stream.Context(), p.recvChan, p.sendChan, p.errChan)
+	return p.plugin.StreamMetrics(ctx, p.recvChan, p.sendChan, p.errChan)
 
 }
 
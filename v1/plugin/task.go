@@ -0,0 +1,257 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/metadata"
+)
+
+// taskIDKey is the gRPC metadata key of the id of the task Snap calls the
+// plugin for.
+const taskIDKey = "task-id"
+
+// TaskInfo describes the task a call from Snap is made for.
+type TaskInfo struct {
+	// ID is the id of the task, empty if Snap did not send one.
+	ID string
+	// Metadata holds the other gRPC metadata sent by Snap with the call,
+	// with keys in lower case.
+	Metadata map[string]string
+}
+
+type taskContextKey struct{}
+
+// TaskFromContext returns the task the context of a call from Snap was
+// made for. It is given by the proxies to ContextCollector,
+// ContextProcessor, ContextPublisher and StreamCollector plugins. ok is
+// false if Snap did not send a task id.
+func TaskFromContext(ctx context.Context) (task TaskInfo, ok bool) {
+	task, _ = ctx.Value(taskContextKey{}).(TaskInfo)
+	return task, task.ID != ""
+}
+
+// withTask returns ctx holding the TaskInfo read from its gRPC metadata.
+func withTask(ctx context.Context) context.Context {
+	return context.WithValue(ctx, taskContextKey{}, taskFromMetadata(ctx))
+}
+
+// taskFromMetadata reads the task from the gRPC metadata of ctx. Keys
+// holding several values are skipped.
+func taskFromMetadata(ctx context.Context) TaskInfo {
+	task := TaskInfo{Metadata: map[string]string{}}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, v := range md {
+		if len(v) != 1 {
+			continue
+		}
+		if k == taskIDKey {
+			task.ID = v[0]
+			continue
+		}
+		task.Metadata[k] = v[0]
+	}
+	return task
+}
+
+// TaskStarter is implemented by collectors, processors and publishers
+// setting up resources per task, like connections or open files.
+// TaskStarted is called with the config of the call before the first call
+// for a task is handed to the plugin. Collectors get the config of the first
+// requested metric. If TaskStarted fails, the call fails and the next call
+// of the task starts it again.
+//
+// Plugins keep the state of each task keyed by its id. Only context-aware
+// plugins can tell the task of a call, see TaskFromContext.
+type TaskStarter interface {
+	TaskStarted(task TaskInfo, cfg Config) error
+}
+
+// TaskStopper is implemented by plugins tearing down resources per task.
+// TaskStopped is called once no call of a started task was made for the
+// idle timeout of the plugin, see TaskIdleTimeout, and for all started
+// tasks when the plugin stops, before its Shutdowner hook is called.
+type TaskStopper interface {
+	TaskStopped(task TaskInfo)
+}
+
+// taskTracker keeps the tasks a plugin was called for, to call its
+// TaskStarter and TaskStopper hooks. The hooks are called without holding
+// the lock, so that a slow hook only delays the calls of its own task.
+type taskTracker struct {
+	mtx         sync.Mutex
+	tasks       map[string]*trackedTask
+	stopping    map[string]*trackedTask
+	idleTimeout time.Duration
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type trackedTask struct {
+	info     TaskInfo
+	lastSeen time.Time
+	// started is closed once TaskStarted returned err
+	started chan struct{}
+	err     error
+	// stopped is closed once TaskStopped returned
+	stopped chan struct{}
+}
+
+func newTaskTracker() *taskTracker {
+	return &taskTracker{
+		tasks:       map[string]*trackedTask{},
+		stopping:    map[string]*trackedTask{},
+		idleTimeout: defaultTaskIdleTimeout,
+		done:        make(chan struct{}),
+	}
+}
+
+// seen records a call for task, starting it if it is new, and stops the
+// tasks which have been idle for too long. Calls of a task being started
+// wait for TaskStarted, and a task being stopped is only started again once
+// TaskStopped returned.
+func (t *taskTracker) seen(plugin Plugin, task TaskInfo, cfg Config) error {
+	now := time.Now()
+	t.mtx.Lock()
+	expired := t.expire(now)
+	tt, ok := t.tasks[task.ID]
+	if ok {
+		tt.lastSeen = now
+		t.mtx.Unlock()
+		t.stop(plugin, expired, "idle")
+		<-tt.started
+		return tt.err
+	}
+	tt = &trackedTask{info: task, lastSeen: now, started: make(chan struct{}), stopped: make(chan struct{})}
+	t.tasks[task.ID] = tt
+	prev := t.stopping[task.ID]
+	t.mtx.Unlock()
+	t.stop(plugin, expired, "idle")
+
+	if prev != nil {
+		<-prev.stopped
+	}
+	if starter, ok := unwrapPlugin(plugin).(TaskStarter); ok {
+		tt.err = starter.TaskStarted(task, cfg)
+	}
+	if tt.err != nil {
+		// the next call of the task starts it again
+		t.mtx.Lock()
+		if t.tasks[task.ID] == tt {
+			delete(t.tasks, task.ID)
+		}
+		t.mtx.Unlock()
+	}
+	close(tt.started)
+	return tt.err
+}
+
+// expire removes the tasks idle for the idle timeout at now and returns
+// them, to be stopped. The caller holds the lock.
+func (t *taskTracker) expire(now time.Time) []*trackedTask {
+	if t.idleTimeout <= 0 {
+		return nil
+	}
+	var expired []*trackedTask
+	for id, tt := range t.tasks {
+		if now.Sub(tt.lastSeen) >= t.idleTimeout {
+			expired = append(expired, t.remove(id, tt))
+		}
+	}
+	return expired
+}
+
+// remove removes the task tt of the given id, marking it as being stopped.
+// The caller holds the lock.
+func (t *taskTracker) remove(id string, tt *trackedTask) *trackedTask {
+	delete(t.tasks, id)
+	t.stopping[id] = tt
+	return tt
+}
+
+// stop calls TaskStopped for the removed tasks which were started, without
+// holding the lock.
+func (t *taskTracker) stop(plugin Plugin, tasks []*trackedTask, reason string) {
+	for _, tt := range tasks {
+		<-tt.started
+		if tt.err == nil {
+			stopTask(plugin, tt.info, reason)
+		}
+		close(tt.stopped)
+		t.mtx.Lock()
+		if t.stopping[tt.info.ID] == tt {
+			delete(t.stopping, tt.info.ID)
+		}
+		t.mtx.Unlock()
+	}
+}
+
+// stopAll stops all tasks and the watch of idle tasks, as the plugin stops.
+func (t *taskTracker) stopAll(plugin Plugin) {
+	t.close()
+	t.mtx.Lock()
+	var tasks []*trackedTask
+	for id, tt := range t.tasks {
+		tasks = append(tasks, t.remove(id, tt))
+	}
+	t.mtx.Unlock()
+	t.stop(plugin, tasks, "plugin stopped")
+}
+
+// watch stops idle tasks until close is called.
+func (t *taskTracker) watch(plugin Plugin) {
+	if t.idleTimeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(t.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case now := <-ticker.C:
+			t.mtx.Lock()
+			expired := t.expire(now)
+			t.mtx.Unlock()
+			t.stop(plugin, expired, "idle")
+		}
+	}
+}
+
+// close ends the watch of idle tasks.
+func (t *taskTracker) close() {
+	t.closeOnce.Do(func() { close(t.done) })
+}
+
+func stopTask(plugin Plugin, task TaskInfo, reason string) {
+	log.WithFields(log.Fields{
+		"_block":  "stopTask",
+		"task-id": task.ID,
+		"reason":  reason,
+	}).Debug("Task stopped")
+	if stopper, ok := unwrapPlugin(plugin).(TaskStopper); ok {
+		stopper.TaskStopped(task)
+	}
+}
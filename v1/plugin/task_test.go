@@ -0,0 +1,206 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin/rpc"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTaskFromContext(t *testing.T) {
+	Convey("Test TaskFromContext", t, func() {
+		Convey("task should be read from the metadata", func() {
+			md := metadata.Pairs("task-id", "1234", "Source", "snapteld", "multi", "a", "multi", "b")
+			task, ok := TaskFromContext(withTask(metadata.NewIncomingContext(context.Background(), md)))
+			So(ok, ShouldBeTrue)
+			So(task, ShouldResemble, TaskInfo{ID: "1234", Metadata: map[string]string{"source": "snapteld"}})
+		})
+		Convey("missing task id should be reported", func() {
+			_, ok := TaskFromContext(withTask(context.Background()))
+			So(ok, ShouldBeFalse)
+			_, ok = TaskFromContext(context.Background())
+			So(ok, ShouldBeFalse)
+		})
+		Convey("proxies should give the task to plugins", func() {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("task-id", "1234"))
+
+			mc := &mockContextCollector{}
+			plugin := withoutContext(mc).(Collector)
+			cp := collectorProxy{pluginProxy: *newPluginProxy(plugin), plugin: plugin}
+			_, err := cp.CollectMetrics(ctx, &rpc.MetricsArg{})
+			So(err, ShouldBeNil)
+			task, _ := TaskFromContext(mc.ctx)
+			So(task.ID, ShouldEqual, "1234")
+
+			mp := &mockContextProcessor{}
+			processor := withoutContext(mp).(Processor)
+			pp := processorProxy{pluginProxy: *newPluginProxy(processor), plugin: processor}
+			_, err = pp.Process(ctx, &rpc.PubProcArg{})
+			So(err, ShouldBeNil)
+			task, _ = TaskFromContext(mp.ctx)
+			So(task.ID, ShouldEqual, "1234")
+
+			mpub := &mockContextPublisher{}
+			publisher := withoutContext(mpub).(Publisher)
+			pubp := publisherProxy{pluginProxy: *newPluginProxy(publisher), plugin: publisher}
+			_, err = pubp.Publish(ctx, &rpc.PubProcArg{})
+			So(err, ShouldBeNil)
+			task, _ = TaskFromContext(mpub.ctx)
+			So(task.ID, ShouldEqual, "1234")
+		})
+	})
+}
+
+type mockTaskPublisher struct {
+	mockContextPublisher
+	mtx       sync.Mutex
+	started   []string
+	stopped   []string
+	startErr  error
+	startHook func(TaskInfo)
+}
+
+func (mp *mockTaskPublisher) TaskStarted(task TaskInfo, cfg Config) error {
+	if mp.startHook != nil {
+		mp.startHook(task)
+	}
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+	if mp.startErr != nil {
+		return mp.startErr
+	}
+	mp.started = append(mp.started, task.ID+":"+cfg["file"].(string))
+	return nil
+}
+
+func (mp *mockTaskPublisher) TaskStopped(task TaskInfo) {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+	mp.stopped = append(mp.stopped, task.ID)
+}
+
+func TestTaskHooks(t *testing.T) {
+	Convey("Test task lifecycle hooks", t, func() {
+		mp := &mockTaskPublisher{}
+		plugin := withoutContext(mp).(Publisher)
+		pp := publisherProxy{pluginProxy: *newPluginProxy(plugin), plugin: plugin}
+		arg := &rpc.PubProcArg{Config: &rpc.ConfigMap{StringMap: map[string]string{"file": "out.log"}}}
+		taskCtx := func(taskID string) context.Context {
+			return metadata.NewIncomingContext(context.Background(), metadata.Pairs("task-id", taskID))
+		}
+		publish := func(taskID string) *rpc.ErrReply {
+			reply, err := pp.Publish(taskCtx(taskID), arg)
+			So(err, ShouldBeNil)
+			return reply
+		}
+
+		Convey("tasks should be started once", func() {
+			publish("a")
+			publish("a")
+			publish("b")
+			So(mp.started, ShouldResemble, []string{"a:out.log", "b:out.log"})
+			So(mp.stopped, ShouldBeEmpty)
+		})
+		Convey("calls without a task id should not start tasks", func() {
+			_, err := pp.Publish(context.Background(), arg)
+			So(err, ShouldBeNil)
+			So(mp.started, ShouldBeEmpty)
+		})
+		Convey("failing to start a task should fail the call and retry", func() {
+			mp.startErr = errors.New("cannot open file")
+			So(publish("a").Error, ShouldEqual, "cannot open file")
+			mp.startErr = nil
+			So(publish("a").Error, ShouldBeEmpty)
+			So(mp.started, ShouldResemble, []string{"a:out.log"})
+		})
+		Convey("idle tasks should be stopped", func() {
+			pp.tasks.idleTimeout = 50 * time.Millisecond
+			publish("a")
+			time.Sleep(100 * time.Millisecond)
+			publish("b")
+			So(mp.stopped, ShouldResemble, []string{"a"})
+			So(mp.started, ShouldResemble, []string{"a:out.log", "b:out.log"})
+		})
+		Convey("a slow TaskStarted should not block other tasks", func() {
+			release := make(chan struct{})
+			mp.startHook = func(task TaskInfo) {
+				if task.ID == "slow" {
+					<-release
+				}
+			}
+			slowDone := make(chan struct{})
+			go func() {
+				pp.Publish(taskCtx("slow"), arg)
+				close(slowDone)
+			}()
+			// wait for the slow task to be starting
+			for {
+				pp.tasks.mtx.Lock()
+				_, starting := pp.tasks.tasks["slow"]
+				pp.tasks.mtx.Unlock()
+				if starting {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			fastDone := make(chan struct{})
+			go func() {
+				pp.Publish(taskCtx("fast"), arg)
+				close(fastDone)
+			}()
+			select {
+			case <-fastDone:
+			case <-time.After(time.Second):
+				t.Error("call of another task was blocked by TaskStarted")
+			}
+			close(release)
+			<-slowDone
+			<-fastDone
+		})
+		Convey("the watch of idle tasks should end on shutdown", func() {
+			pp.tasks.idleTimeout = 20 * time.Millisecond
+			publish("a")
+			watchDone := make(chan struct{})
+			go func() {
+				pp.tasks.watch(pp.plugin)
+				close(watchDone)
+			}()
+			time.Sleep(50 * time.Millisecond)
+			pp.shutdown(&mockServer{}, "killed")
+			<-watchDone
+			So(mp.stopped, ShouldResemble, []string{"a"})
+		})
+		Convey("all tasks should be stopped on shutdown", func() {
+			publish("a")
+			pp.shutdown(&mockServer{}, "killed")
+			So(mp.stopped, ShouldResemble, []string{"a"})
+		})
+	})
+}